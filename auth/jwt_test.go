@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+var testSecret = []byte("secret")
+
+// 以任意协议头签发令牌，用于构造非 HS256 的令牌
+func signWithHeader(t *testing.T, header string, claims *Claims) string {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signing := base64.RawURLEncoding.EncodeToString([]byte(header)) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signing + "." + base64.RawURLEncoding.EncodeToString(sign(testSecret, signing))
+}
+
+func mustSign(t *testing.T, claims *Claims) string {
+	token, err := SignHS256(testSecret, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestHMACVerifier(t *testing.T) {
+	now := time.Now().Unix()
+	valid := mustSign(t, &Claims{Subject: "alice", Issuer: "zrpc", Audience: Audience{"user"}, ExpiresAt: now + 60})
+	otherSecret, err := SignHS256([]byte("other"), &Claims{Subject: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	noneToken := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"alice"}`)) + "."
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"valid", valid, nil},
+		{"bad signature", valid[:len(valid)-2] + "xx", ErrSignature},
+		{"other secret", otherSecret, ErrSignature},
+		{"alg none", noneToken, ErrSignature},
+		{"alg none signed", signWithHeader(t, `{"alg":"none"}`, &Claims{Subject: "alice"}), ErrSignature},
+		{"alg HS512", signWithHeader(t, `{"alg":"HS512","typ":"JWT"}`, &Claims{Subject: "alice"}), ErrSignature},
+		{"alg RS256", signWithHeader(t, `{"alg":"RS256","typ":"JWT"}`, &Claims{Subject: "alice"}), ErrSignature},
+		{"malformed", "a.b", ErrMalformedToken},
+		{"expired", mustSign(t, &Claims{Issuer: "zrpc", Audience: Audience{"user"}, ExpiresAt: now - 60}), ErrExpired},
+		{"not yet valid", mustSign(t, &Claims{Issuer: "zrpc", Audience: Audience{"user"}, NotBefore: now + 60}), ErrNotYetValid},
+		{"issuer mismatch", mustSign(t, &Claims{Issuer: "other", Audience: Audience{"user"}}), ErrIssuer},
+		{"audience mismatch", mustSign(t, &Claims{Issuer: "zrpc", Audience: Audience{"admin"}}), ErrAudience},
+	}
+	verifier := &HMACVerifier{Secret: testSecret, Issuer: "zrpc", Audience: "user"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := verifier.Verify(context.Background(), tt.token)
+			if err != tt.want {
+				t.Fatalf("Verify: got %v, want %v", err, tt.want)
+			}
+			if err == nil && claims.Subject != "alice" {
+				t.Fatalf("subject = %q, want alice", claims.Subject)
+			}
+		})
+	}
+}
+
+// 过期及生效时间在允许的时钟偏差内仍然有效
+func TestHMACVerifierLeeway(t *testing.T) {
+	now := time.Now().Unix()
+	verifier := &HMACVerifier{Secret: testSecret, Leeway: 30 * time.Second}
+	tests := []struct {
+		name   string
+		claims *Claims
+		want   error
+	}{
+		{"expired within leeway", &Claims{ExpiresAt: now - 10}, nil},
+		{"expired beyond leeway", &Claims{ExpiresAt: now - 60}, ErrExpired},
+		{"not before within leeway", &Claims{NotBefore: now + 10}, nil},
+		{"not before beyond leeway", &Claims{NotBefore: now + 60}, ErrNotYetValid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := verifier.Verify(context.Background(), mustSign(t, tt.claims)); err != tt.want {
+				t.Fatalf("Verify: got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAudienceUnmarshal(t *testing.T) {
+	var claims Claims
+	if err := json.Unmarshal([]byte(`{"aud":"a"}`), &claims); err != nil || len(claims.Audience) != 1 || claims.Audience[0] != "a" {
+		t.Fatalf("single audience: %v %v", claims.Audience, err)
+	}
+	if err := json.Unmarshal([]byte(`{"aud":["a","b"]}`), &claims); err != nil || len(claims.Audience) != 2 {
+		t.Fatalf("audience list: %v %v", claims.Audience, err)
+	}
+}
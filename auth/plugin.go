@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"context"
+	"github.com/zhangweijie11/zRPC/metadata"
+	"github.com/zhangweijie11/zRPC/protocol"
+	"github.com/zhangweijie11/zRPC/provider"
+	"github.com/zhangweijie11/zRPC/status"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 缓存的已校验令牌数上限，超过时清空
+const maxCachedTokens = 1024
+
+// ACL 服务的访问控制，按方法名声明允许调用的角色，键为 "*" 的规则作用于未单独声明的方法。
+// 角色列表包含 "*" 时允许任何已认证的调用方，未匹配任何规则的方法拒绝调用
+type ACL map[string][]string
+
+// 调用方的角色是否允许调用方法
+func (acl ACL) allows(method string, roles []string) bool {
+	allowed, ok := acl[method]
+	if !ok {
+		if allowed, ok = acl["*"]; !ok {
+			return false
+		}
+	}
+	for _, role := range allowed {
+		if role == "*" || contains(roles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// PluginOption 鉴权插件配置
+type PluginOption struct {
+	// 校验结果的缓存时间，期间同一令牌不再调用校验器，校验器吊销令牌最多在该时间后生效；0 表示不缓存
+	CacheTTL time.Duration
+}
+
+var DefaultPluginOption = PluginOption{
+	CacheTTL: 10 * time.Second,
+}
+
+// Plugin 服务端鉴权插件：读取请求后校验元数据中的 Bearer 令牌，令牌缺失或无效时返回 Unauthenticated，
+// 请求以错误响应结束，连接继续可用。访问控制由注册服务时传入的 Require 拦截器执行。
+// 令牌需通过 v2 连接的元数据发送，v1 连接上的请求均被拒绝
+type Plugin struct {
+	verifier Verifier
+	option   PluginOption
+
+	mutex  sync.Mutex
+	claims map[string]*cachedClaims // 已校验的令牌，避免同一令牌的每次请求都重新校验
+}
+
+// 缓存的校验结果
+type cachedClaims struct {
+	claims    *Claims
+	expiresAt time.Time // 缓存失效的时间，不晚于令牌的过期时间
+}
+
+// NewPlugin 初始化鉴权插件，通过 RPCServer.AddPlugin 添加
+func NewPlugin(verifier Verifier, option PluginOption) *Plugin {
+	return &Plugin{verifier: verifier, option: option, claims: make(map[string]*cachedClaims)}
+}
+
+// AfterRead 校验请求的令牌，其他帧不校验。在连接的读取协程中执行，校验器不宜阻塞过久
+func (p *Plugin) AfterRead(msg *protocol.RPCMsg, err error) error {
+	if err != nil || msg == nil || msg.MsgType() != protocol.Request {
+		return nil
+	}
+	_, err = p.authenticate(context.Background(), msg.Metadata)
+	return err
+}
+
+// Interceptor 全局拦截器，将调用方的令牌声明放入调用上下文，处理方法可通过 ClaimsFromContext 获取
+func (p *Plugin) Interceptor() provider.Interceptor {
+	return p.Require(nil)
+}
+
+// Require 服务拦截器，注册服务时传入以声明该服务的访问控制，调用方的角色不满足时返回 PermissionDenied。
+// acl 为空时不限制。调用方的令牌声明同样放入调用上下文
+func (p *Plugin) Require(acl ACL) provider.Interceptor {
+	return func(ctx context.Context, info *provider.MethodInfo, args []interface{}, next provider.UnaryHandler) ([]interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		claims, err := p.authenticate(ctx, md)
+		if err != nil {
+			return nil, err
+		}
+		if acl != nil && !acl.allows(info.Method, claims.Roles) {
+			return nil, status.Errorf(status.PermissionDenied, "%s 无权调用 %s.%s！", claims.Subject, info.Class, info.Method)
+		}
+		return next(context.WithValue(ctx, claimsKey{}, claims), args)
+	}
+}
+
+// 校验元数据中的令牌，缓存时间内已校验的令牌直接返回缓存的声明
+func (p *Plugin) authenticate(ctx context.Context, md metadata.MD) (*Claims, error) {
+	token, ok := bearerToken(md)
+	if !ok {
+		return nil, status.New(status.Unauthenticated, "缺少令牌！")
+	}
+
+	now := time.Now()
+	p.mutex.Lock()
+	cached, ok := p.claims[token]
+	p.mutex.Unlock()
+	if ok && now.Before(cached.expiresAt) {
+		return cached.claims, nil
+	}
+
+	claims, err := p.verifier.Verify(ctx, token)
+	if err != nil {
+		return nil, status.Errorf(status.Unauthenticated, "令牌无效：%v", err)
+	}
+	if p.option.CacheTTL > 0 {
+		expiresAt := now.Add(p.option.CacheTTL)
+		if claims.ExpiresAt != 0 && time.Unix(claims.ExpiresAt, 0).Before(expiresAt) {
+			expiresAt = time.Unix(claims.ExpiresAt, 0)
+		}
+		p.mutex.Lock()
+		if len(p.claims) >= maxCachedTokens {
+			p.claims = make(map[string]*cachedClaims)
+		}
+		p.claims[token] = &cachedClaims{claims: claims, expiresAt: expiresAt}
+		p.mutex.Unlock()
+	}
+	return claims, nil
+}
+
+func bearerToken(md metadata.MD) (string, bool) {
+	value, ok := md[MetadataKey]
+	if !ok || !strings.HasPrefix(value, bearerPrefix) {
+		return "", false
+	}
+	token := strings.TrimSpace(value[len(bearerPrefix):])
+	return token, token != ""
+}
+
+type claimsKey struct{}
+
+// ClaimsFromContext 获取调用方的令牌声明，需经过插件的 Interceptor 或 Require 拦截器
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*Claims)
+	return claims, ok
+}
@@ -0,0 +1,188 @@
+package auth_test
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zhangweijie11/zRPC/auth"
+	"github.com/zhangweijie11/zRPC/consumer"
+	"github.com/zhangweijie11/zRPC/provider"
+	"github.com/zhangweijie11/zRPC/status"
+	"github.com/zhangweijie11/zRPC/zrpctest"
+)
+
+var secret = []byte("secret")
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+type Account struct{}
+
+func (a *Account) Owner(ctx context.Context) (string, error) {
+	claims, ok := auth.ClaimsFromContext(ctx)
+	if !ok {
+		return "", status.New(status.Internal, "missing claims")
+	}
+	return claims.Subject, nil
+}
+
+func (a *Account) Delete(ctx context.Context) (string, error) {
+	return "deleted", nil
+}
+
+// 可吊销令牌的校验器，记录校验次数
+type revokingVerifier struct {
+	auth.Verifier
+	mutex   sync.Mutex
+	calls   int
+	revoked bool
+}
+
+func (v *revokingVerifier) Verify(ctx context.Context, token string) (*auth.Claims, error) {
+	v.mutex.Lock()
+	v.calls++
+	revoked := v.revoked
+	v.mutex.Unlock()
+	if revoked {
+		return nil, auth.ErrSignature
+	}
+	return v.Verifier.Verify(ctx, token)
+}
+
+func (v *revokingVerifier) revoke() {
+	v.mutex.Lock()
+	v.revoked = true
+	v.mutex.Unlock()
+}
+
+func (v *revokingVerifier) count() int {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	return v.calls
+}
+
+func startAccount(t *testing.T, verifier auth.Verifier, option auth.PluginOption) *zrpctest.Server {
+	plugin := auth.NewPlugin(verifier, option)
+	srv := zrpctest.NewServer(zrpctest.Config{}, func(rs *provider.RPCServer) {
+		rs.AddPlugin(plugin)
+		rs.Register(&Account{}, plugin.Require(auth.ACL{"Owner": {"*"}, "Delete": {"admin"}}))
+	})
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newClient(t *testing.T, srv *zrpctest.Server, token string) *consumer.RPCClient {
+	cli, err := srv.NewClient(consumer.DefaultOption)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cli.Close)
+	if token != "" {
+		cli.Use(auth.ClientInterceptor(auth.StaticToken(token)))
+	}
+	return cli
+}
+
+func sign(t *testing.T, claims *auth.Claims) string {
+	token, err := auth.SignHS256(secret, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+var (
+	owner  = &consumer.Service{Class: "Account", Method: "Owner"}
+	remove = &consumer.Service{Class: "Account", Method: "Delete"}
+)
+
+func TestMissingToken(t *testing.T) {
+	srv := startAccount(t, auth.NewHMACVerifier(secret), auth.DefaultPluginOption)
+	cli := newClient(t, srv, "")
+	if _, err := cli.Call(context.Background(), owner, nil); status.CodeOf(err) != status.Unauthenticated {
+		t.Fatalf("call without token: got %v, want Unauthenticated", err)
+	}
+}
+
+func TestInvalidToken(t *testing.T) {
+	srv := startAccount(t, auth.NewHMACVerifier(secret), auth.DefaultPluginOption)
+	token, err := auth.SignHS256([]byte("other"), &auth.Claims{Subject: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli := newClient(t, srv, token)
+	if _, err := cli.Call(context.Background(), owner, nil); status.CodeOf(err) != status.Unauthenticated {
+		t.Fatalf("call with forged token: got %v, want Unauthenticated", err)
+	}
+}
+
+// ACL 拒绝的调用以 PermissionDenied 错误帧返回，同一连接上的后续调用不受影响
+func TestRequireDenied(t *testing.T) {
+	srv := startAccount(t, auth.NewHMACVerifier(secret), auth.DefaultPluginOption)
+	cli := newClient(t, srv, sign(t, &auth.Claims{Subject: "alice", Roles: []string{"user"}}))
+
+	if _, err := cli.Call(context.Background(), remove, nil); status.CodeOf(err) != status.PermissionDenied {
+		t.Fatalf("Delete: got %v, want PermissionDenied", err)
+	}
+	res, err := cli.Call(context.Background(), owner, nil)
+	if err != nil {
+		t.Fatalf("Owner after denial: %v", err)
+	}
+	if len(res) == 0 || res[0] != "alice" {
+		t.Fatalf("Owner = %v, want alice", res)
+	}
+}
+
+func TestRequireAllowed(t *testing.T) {
+	srv := startAccount(t, auth.NewHMACVerifier(secret), auth.DefaultPluginOption)
+	cli := newClient(t, srv, sign(t, &auth.Claims{Subject: "root", Roles: []string{"admin"}}))
+	if _, err := cli.Call(context.Background(), remove, nil); err != nil {
+		t.Fatalf("Delete as admin: %v", err)
+	}
+}
+
+// 关闭缓存时每次调用都经过校验器，吊销的令牌立即失效
+func TestNoCacheRevocation(t *testing.T) {
+	verifier := &revokingVerifier{Verifier: auth.NewHMACVerifier(secret)}
+	srv := startAccount(t, verifier, auth.PluginOption{})
+	cli := newClient(t, srv, sign(t, &auth.Claims{Subject: "alice"}))
+
+	if _, err := cli.Call(context.Background(), owner, nil); err != nil {
+		t.Fatal(err)
+	}
+	verifier.revoke()
+	if _, err := cli.Call(context.Background(), owner, nil); status.CodeOf(err) != status.Unauthenticated {
+		t.Fatalf("call after revocation: got %v, want Unauthenticated", err)
+	}
+}
+
+// 缓存时间内不重复校验，过期后吊销生效
+func TestCacheTTL(t *testing.T) {
+	verifier := &revokingVerifier{Verifier: auth.NewHMACVerifier(secret)}
+	srv := startAccount(t, verifier, auth.PluginOption{CacheTTL: 200 * time.Millisecond})
+	cli := newClient(t, srv, sign(t, &auth.Claims{Subject: "alice"}))
+
+	for i := 0; i < 3; i++ {
+		if _, err := cli.Call(context.Background(), owner, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := verifier.count(); n != 1 {
+		t.Fatalf("verifier called %d times within the TTL, want 1", n)
+	}
+	verifier.revoke()
+	if _, err := cli.Call(context.Background(), owner, nil); err != nil {
+		t.Fatalf("call within the TTL after revocation: %v", err)
+	}
+	time.Sleep(250 * time.Millisecond)
+	if _, err := cli.Call(context.Background(), owner, nil); status.CodeOf(err) != status.Unauthenticated {
+		t.Fatalf("call after the TTL: got %v, want Unauthenticated", err)
+	}
+}
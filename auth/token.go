@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"context"
+	"github.com/zhangweijie11/zRPC/consumer"
+	"github.com/zhangweijie11/zRPC/metadata"
+	"sync"
+	"time"
+)
+
+const (
+	// MetadataKey 携带令牌的元数据键
+	MetadataKey = "authorization"
+	// 令牌的前缀
+	bearerPrefix = "Bearer "
+)
+
+// TokenSource 为每次调用提供令牌
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// StaticToken 固定的令牌
+type StaticToken string
+
+// Token 返回固定的令牌
+func (t StaticToken) Token(context.Context) (string, error) {
+	return string(t), nil
+}
+
+// FetchFunc 获取新令牌及其过期时间
+type FetchFunc func(ctx context.Context) (token string, expiry time.Time, err error)
+
+// RefreshingTokenSource 缓存令牌，在过期前 refreshBefore 内重新获取，并发的调用只触发一次获取
+type RefreshingTokenSource struct {
+	fetch         FetchFunc
+	refreshBefore time.Duration
+
+	mutex  sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// NewRefreshingTokenSource 初始化自动刷新的令牌来源，refreshBefore 为提前刷新的时间
+func NewRefreshingTokenSource(fetch FetchFunc, refreshBefore time.Duration) *RefreshingTokenSource {
+	return &RefreshingTokenSource{fetch: fetch, refreshBefore: refreshBefore}
+}
+
+// Token 返回缓存的令牌，即将过期时重新获取。获取失败但旧令牌尚未过期时继续使用旧令牌
+func (ts *RefreshingTokenSource) Token(ctx context.Context) (string, error) {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+
+	now := time.Now()
+	if ts.token != "" && now.Add(ts.refreshBefore).Before(ts.expiry) {
+		return ts.token, nil
+	}
+	token, expiry, err := ts.fetch(ctx)
+	if err != nil {
+		if ts.token != "" && now.Before(ts.expiry) {
+			return ts.token, nil
+		}
+		return "", err
+	}
+	ts.token, ts.expiry = token, expiry
+	return token, nil
+}
+
+// ClientInterceptor 客户端拦截器，将令牌以 Bearer 形式放入调用的元数据。
+// 元数据只能通过 v2 连接发送，v1 连接上的调用会被服务端拒绝
+func ClientInterceptor(source TokenSource) consumer.Interceptor {
+	return func(ctx context.Context, service *consumer.Service, args []interface{}, invoker consumer.Invoker) ([]interface{}, error) {
+		token, err := source.Token(ctx)
+		if err != nil {
+			return nil, err
+		}
+		ctx = metadata.AppendToOutgoingContext(ctx, MetadataKey, bearerPrefix+token)
+		return invoker(ctx, service, args)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/zhangweijie11/zRPC/naming"
+	"net/http"
+	"strings"
+)
+
+// 与 naming.Discovery 请求的接口一致
+const (
+	registerPath = "/api/register"
+	renewPath    = "/api/renew"
+	cancelPath   = "/api/cancel"
+	fetchPath    = "/api/fetch"
+	nodesPath    = "/api/nodes"
+)
+
+// 注册中心节点在 /api/nodes 中使用的 AppID
+const nodeAppID = "zrpc-registry"
+
+// 响应格式与 naming.Response 一致，Code 为 200 表示成功
+type response struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data"`
+}
+
+type fetchParams struct {
+	Env    string `json:"env"`
+	AppID  string `json:"appid"`
+	Status uint32 `json:"status"`
+}
+
+type server struct {
+	registry *registry
+	nodes    []string      // 集群所有节点，包括本节点
+	peers    []*replicator // 其他节点
+}
+
+func (s *server) routes(engine *gin.Engine) {
+	engine.POST(registerPath, s.register)
+	engine.POST(renewPath, s.renew)
+	engine.POST(cancelPath, s.cancel)
+	engine.POST(fetchPath, s.fetch)
+	engine.POST(nodesPath, s.listNodes)
+}
+
+func reply(c *gin.Context, code int, message string, data interface{}) {
+	c.JSON(http.StatusOK, response{Code: code, Message: message, Data: data})
+}
+
+// 解析实例参数，AppID 与 hostname 必填
+func bindInstance(c *gin.Context) (*naming.Instance, bool) {
+	instance := &naming.Instance{}
+	if err := c.ShouldBindJSON(instance); err != nil {
+		reply(c, http.StatusBadRequest, err.Error(), nil)
+		return nil, false
+	}
+	if instance.AppID == "" || instance.Hostname == "" {
+		reply(c, http.StatusBadRequest, "appid 和 hostname 不能为空", nil)
+		return nil, false
+	}
+	return instance, true
+}
+
+// 客户端的写操作同步给其他节点，节点间同步的请求不再转发
+func (s *server) replicate(c *gin.Context, path string, instance *naming.Instance) {
+	if c.GetHeader(replicationHeader) != "" {
+		return
+	}
+	for _, peer := range s.peers {
+		peer.replicate(path, instance)
+	}
+}
+
+func (s *server) register(c *gin.Context) {
+	instance, ok := bindInstance(c)
+	if !ok {
+		return
+	}
+	if instance.Status == 0 {
+		instance.Status = statusUp
+	}
+	s.registry.register(instance)
+	s.replicate(c, registerPath, instance)
+	reply(c, http.StatusOK, "", nil)
+}
+
+func (s *server) renew(c *gin.Context) {
+	params, ok := bindInstance(c)
+	if !ok {
+		return
+	}
+	instance, ok := s.registry.renew(params.Env, params.AppID, params.Hostname)
+	if !ok {
+		reply(c, http.StatusNotFound, "实例不存在", nil)
+		return
+	}
+	s.replicate(c, renewPath, instance)
+	reply(c, http.StatusOK, "", nil)
+}
+
+func (s *server) cancel(c *gin.Context) {
+	params, ok := bindInstance(c)
+	if !ok {
+		return
+	}
+	instance, ok := s.registry.cancel(params.Env, params.AppID, params.Hostname)
+	if !ok {
+		reply(c, http.StatusNotFound, "实例不存在", nil)
+		return
+	}
+	s.replicate(c, cancelPath, instance)
+	reply(c, http.StatusOK, "", nil)
+}
+
+func (s *server) fetch(c *gin.Context) {
+	params := fetchParams{}
+	if err := c.ShouldBindJSON(&params); err != nil {
+		reply(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	if params.AppID == "" {
+		reply(c, http.StatusBadRequest, "appid 不能为空", nil)
+		return
+	}
+	data, ok := s.registry.fetch(params.Env, params.AppID, params.Status)
+	if !ok {
+		reply(c, http.StatusNotFound, "服务不存在", nil)
+		return
+	}
+	reply(c, http.StatusOK, "", data)
+}
+
+// 返回集群的所有节点，格式与 fetch 相同，地址带 http:// 前缀
+func (s *server) listNodes(c *gin.Context) {
+	params := fetchParams{}
+	if err := c.ShouldBindJSON(&params); err != nil {
+		reply(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	data := naming.FetchData{}
+	for _, node := range s.nodes {
+		data.Instances = append(data.Instances, &naming.Instance{
+			Env:       params.Env,
+			AppID:     nodeAppID,
+			Hostname:  node,
+			Addresses: []string{"http://" + strings.TrimPrefix(node, "http://")},
+			Status:    statusUp,
+		})
+	}
+	reply(c, http.StatusOK, "", data)
+}
@@ -0,0 +1,140 @@
+// zrpc-registry 注册中心服务，实现 naming.Discovery 使用的 HTTP 接口。
+// 实例按环境隔离，停止续约的实例在租约过期后剔除；多节点部署时写操作同步给其他节点
+package main
+
+import (
+	"context"
+	"flag"
+	"github.com/gin-gonic/gin"
+	"github.com/zhangweijie11/zRPC/naming"
+	"gopkg.in/yaml.v3"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+type Config struct {
+	Addr  string   `yaml:"addr"`  // 监听地址
+	Self  string   `yaml:"self"`  // 本节点供其他节点及客户端访问的地址，为空时由监听地址推断
+	Nodes []string `yaml:"nodes"` // 集群所有节点的地址，可包含本节点
+
+	LeaseTTL       time.Duration `yaml:"lease_ttl"`       // 租约时长，超过该时间未续约的实例被剔除
+	EvictInterval  time.Duration `yaml:"evict_interval"`  // 检查租约过期的间隔
+	RenewThreshold float64       `yaml:"renew_threshold"` // 一轮剔除后需保留的实例比例，低于该比例时进入自我保护
+	// 启用自我保护的最少实例数，所有环境的实例总数低于该值时过期实例总是被剔除
+	SelfPreservationMinInstances int `yaml:"self_preservation_min_instances"`
+	// 关闭自我保护，过期实例总是被剔除
+	DisableSelfPreservation bool `yaml:"disable_self_preservation"`
+	Debug                   bool `yaml:"debug"`
+}
+
+var DefaultConfig = Config{
+	Addr:           ":7171",
+	LeaseTTL:       2 * naming.RenewInterval, // 允许错过一次续约
+	EvictInterval:  naming.RenewInterval,
+	RenewThreshold: 0.85,
+
+	SelfPreservationMinInstances: 5,
+}
+
+func loadConfig(path string) (*Config, error) {
+	config := DefaultConfig
+	if path == "" {
+		return &config, nil
+	}
+	configFile, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	err = yaml.Unmarshal(configFile, &config)
+	if err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+func main() {
+	configPath := flag.String("config", "", "配置文件路径")
+	addr := flag.String("addr", "", "监听地址，覆盖配置文件")
+	self := flag.String("self", "", "本节点地址，覆盖配置文件")
+	nodes := flag.String("nodes", "", "集群节点地址，逗号分隔，覆盖配置文件")
+	flag.Parse()
+
+	config, err := loadConfig(*configPath)
+	if err != nil {
+		log.Fatalln("读取配置文件出错！", err)
+	}
+	if *addr != "" {
+		config.Addr = *addr
+	}
+	if *self != "" {
+		config.Self = *self
+	}
+	if *nodes != "" {
+		config.Nodes = strings.Split(*nodes, ",")
+	}
+	if config.Self == "" {
+		config.Self = config.Addr
+		if strings.HasPrefix(config.Self, ":") {
+			config.Self = "127.0.0.1" + config.Self
+		}
+	}
+	// 节点地址统一去掉 http:// 前缀后比较，避免向本节点同步
+	config.Self = nodeAddr(config.Self)
+	threshold := config.RenewThreshold
+	if config.DisableSelfPreservation {
+		threshold = 0
+	}
+
+	srv := &server{
+		registry: newRegistry(config.LeaseTTL, threshold, config.SelfPreservationMinInstances),
+		nodes:    []string{config.Self},
+	}
+	for _, node := range config.Nodes {
+		node = nodeAddr(node)
+		if node == "" || node == config.Self {
+			continue
+		}
+		srv.nodes = append(srv.nodes, node)
+		srv.peers = append(srv.peers, newReplicator(node))
+	}
+
+	if !config.Debug {
+		gin.SetMode(gin.ReleaseMode)
+	}
+	engine := gin.New()
+	engine.Use(gin.Recovery())
+	srv.routes(engine)
+	httpServer := &http.Server{Addr: config.Addr, Handler: engine}
+
+	done := make(chan struct{})
+	go srv.registry.runEvict(config.EvictInterval, done)
+	go func() {
+		log.Printf("注册中心启动, 地址: %s, 节点: %v\n", config.Addr, srv.nodes)
+		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalln(err)
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT)
+	<-quit
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := httpServer.Shutdown(ctx); err != nil {
+		log.Println(err)
+	}
+	close(done)
+	for _, peer := range srv.peers {
+		peer.close()
+	}
+}
+
+// 去掉节点地址的 http:// 前缀
+func nodeAddr(node string) string {
+	return strings.TrimPrefix(strings.TrimSpace(node), "http://")
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"github.com/zhangweijie11/zRPC/naming"
+	"log"
+	"sync"
+	"time"
+)
+
+// 实例状态，与 naming.Discovery 注册时上报的状态一致
+const statusUp = 1
+
+// 实例及其租约
+type lease struct {
+	instance  *naming.Instance
+	renewedAt time.Time // 最近一次续约时间
+}
+
+// 应用的所有实例
+type app struct {
+	leases          map[string]*lease // 按 hostname 索引
+	latestTimestamp int64             // 最近一次变化的时间，纳秒
+}
+
+// registry 按环境隔离的实例表，租约过期的实例由 evict 剔除。
+// 一轮中过期的实例比例过高时，多半是注册中心自身与服务之间的网络出现问题，
+// 此时进入自我保护，暂停剔除，直到续约恢复。实例总数少于 minInstances 时比例没有参考意义，不进入自我保护
+type registry struct {
+	mutex    sync.RWMutex
+	envs     map[string]map[string]*app // 环境 -> AppID -> 应用
+	leaseTTL time.Duration              // 租约时长，超过该时间未续约视为过期
+	// 一轮剔除后需保留的实例比例，低于该比例时进入自我保护，0 表示关闭自我保护
+	renewThreshold float64
+	minInstances   int  // 启用自我保护的最少实例数
+	preserving     bool // 是否处于自我保护
+}
+
+func newRegistry(leaseTTL time.Duration, renewThreshold float64, minInstances int) *registry {
+	return &registry{
+		envs:           make(map[string]map[string]*app),
+		leaseTTL:       leaseTTL,
+		renewThreshold: renewThreshold,
+		minInstances:   minInstances,
+	}
+}
+
+// 注册实例，同一应用下 hostname 相同的实例被替换
+func (r *registry) register(instance *naming.Instance) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	apps, ok := r.envs[instance.Env]
+	if !ok {
+		apps = make(map[string]*app)
+		r.envs[instance.Env] = apps
+	}
+	a, ok := apps[instance.AppID]
+	if !ok {
+		a = &app{leases: make(map[string]*lease)}
+		apps[instance.AppID] = a
+	}
+	now := time.Now()
+	a.leases[instance.Hostname] = &lease{instance: instance, renewedAt: now}
+	a.latestTimestamp = now.UnixNano()
+}
+
+// 续约，返回续约的实例，实例不存在时返回 false，由调用方重新注册
+func (r *registry) renew(env, appID, hostname string) (*naming.Instance, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	a, ok := r.envs[env][appID]
+	if !ok {
+		return nil, false
+	}
+	l, ok := a.leases[hostname]
+	if !ok {
+		return nil, false
+	}
+	l.renewedAt = time.Now()
+	return l.instance, true
+}
+
+// 注销实例，返回注销的实例，实例不存在时返回 false
+func (r *registry) cancel(env, appID, hostname string) (*naming.Instance, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	a, ok := r.envs[env][appID]
+	if !ok {
+		return nil, false
+	}
+	l, ok := a.leases[hostname]
+	if !ok {
+		return nil, false
+	}
+	r.remove(env, appID, hostname)
+	return l.instance, true
+}
+
+// 删除实例，需持有锁调用
+func (r *registry) remove(env, appID, hostname string) {
+	apps := r.envs[env]
+	a := apps[appID]
+	delete(a.leases, hostname)
+	a.latestTimestamp = time.Now().UnixNano()
+	if len(a.leases) == 0 {
+		delete(apps, appID)
+	}
+	if len(apps) == 0 {
+		delete(r.envs, env)
+	}
+}
+
+// 获取应用的实例，status 不为 0 时只返回该状态的实例
+func (r *registry) fetch(env, appID string, status uint32) (naming.FetchData, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	a, ok := r.envs[env][appID]
+	if !ok {
+		return naming.FetchData{}, false
+	}
+	data := naming.FetchData{LatestTimestamp: a.latestTimestamp}
+	for _, l := range a.leases {
+		if status != 0 && l.instance.Status != status {
+			continue
+		}
+		instance := *l.instance
+		data.Instances = append(data.Instances, &instance)
+	}
+	return data, len(data.Instances) > 0
+}
+
+// 剔除租约过期的实例
+func (r *registry) evict(now time.Time) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	type key struct{ env, appID, hostname string }
+	var total int
+	var expired []key
+	for env, apps := range r.envs {
+		for appID, a := range apps {
+			for hostname, l := range a.leases {
+				total++
+				if now.Sub(l.renewedAt) > r.leaseTTL {
+					expired = append(expired, key{env, appID, hostname})
+				}
+			}
+		}
+	}
+
+	// 单个实例过期视为该实例自身故障，总是剔除；实例较少时（如整个应用重新部署）同样总是剔除
+	if r.renewThreshold > 0 && total >= r.minInstances && len(expired) > 1 &&
+		float64(total-len(expired)) < float64(total)*r.renewThreshold {
+		if !r.preserving {
+			r.preserving = true
+			log.Printf("进入自我保护，%d 个实例中有 %d 个租约过期，暂停剔除\n", total, len(expired))
+		}
+		return
+	}
+	if r.preserving {
+		r.preserving = false
+		log.Println("续约已恢复，退出自我保护")
+	}
+	for _, k := range expired {
+		log.Printf("租约过期，剔除实例, env: %s, appid: %s, hostname: %s\n", k.env, k.appID, k.hostname)
+		r.remove(k.env, k.appID, k.hostname)
+	}
+}
+
+// 定期剔除过期实例，done 关闭时退出
+func (r *registry) runEvict(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			r.evict(now)
+		case <-done:
+			return
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/zhangweijie11/zRPC/naming"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+const testTTL = time.Minute
+
+func newInstance(env, appID, hostname string) *naming.Instance {
+	return &naming.Instance{Env: env, AppID: appID, Hostname: hostname, Addresses: []string{"tcp://" + hostname}, Status: statusUp}
+}
+
+// 将实例的续约时间提前，模拟停止续约
+func expire(r *registry, env, appID, hostname string) {
+	r.envs[env][appID].leases[hostname].renewedAt = time.Now().Add(-2 * testTTL)
+}
+
+func count(r *registry, env, appID string) int {
+	data, _ := r.fetch(env, appID, 0)
+	return len(data.Instances)
+}
+
+func TestEvictExpiredLease(t *testing.T) {
+	r := newRegistry(testTTL, 0.85, 5)
+	r.register(newInstance("prod", "app", "a"))
+	r.register(newInstance("prod", "app", "b"))
+	expire(r, "prod", "app", "a")
+
+	r.evict(time.Now())
+	data, ok := r.fetch("prod", "app", 0)
+	if !ok || len(data.Instances) != 1 || data.Instances[0].Hostname != "b" {
+		t.Fatalf("after evict: %+v", data.Instances)
+	}
+	if _, ok = r.renew("prod", "app", "a"); ok {
+		t.Fatal("renew of an evicted instance succeeded")
+	}
+}
+
+// 实例数少于自我保护的最少实例数时，全部过期也会被剔除
+func TestEvictSmallAppSet(t *testing.T) {
+	r := newRegistry(testTTL, 0.85, 5)
+	r.register(newInstance("prod", "app", "a"))
+	r.register(newInstance("prod", "app", "b"))
+	expire(r, "prod", "app", "a")
+	expire(r, "prod", "app", "b")
+
+	r.evict(time.Now())
+	if _, ok := r.fetch("prod", "app", 0); ok {
+		t.Fatal("expired instances of a small app set not evicted")
+	}
+	if r.preserving {
+		t.Fatal("entered self-preservation below the minimum instance count")
+	}
+}
+
+func TestFetchEnvIsolation(t *testing.T) {
+	r := newRegistry(testTTL, 0.85, 5)
+	r.register(newInstance("prod", "app", "a"))
+	r.register(newInstance("test", "app", "b"))
+	down := newInstance("prod", "app", "c")
+	down.Status = 2
+	r.register(down)
+
+	data, ok := r.fetch("prod", "app", statusUp)
+	if !ok || len(data.Instances) != 1 || data.Instances[0].Hostname != "a" {
+		t.Fatalf("prod up instances: %+v", data.Instances)
+	}
+	if n := count(r, "prod", "app"); n != 2 {
+		t.Fatalf("prod instances = %d, want 2", n)
+	}
+	data, ok = r.fetch("test", "app", 0)
+	if !ok || len(data.Instances) != 1 || data.Instances[0].Hostname != "b" {
+		t.Fatalf("test instances: %+v", data.Instances)
+	}
+	if _, ok = r.fetch("dev", "app", 0); ok {
+		t.Fatal("fetch from an empty env succeeded")
+	}
+	// 其他环境的同名实例不受注销影响
+	if _, ok = r.cancel("test", "app", "a"); ok {
+		t.Fatal("cancel across envs succeeded")
+	}
+}
+
+// 大量实例同时过期时进入自我保护暂停剔除，续约恢复后退出并剔除仍未续约的实例
+func TestSelfPreservation(t *testing.T) {
+	r := newRegistry(testTTL, 0.85, 5)
+	for i := 0; i < 10; i++ {
+		r.register(newInstance("prod", "app", fmt.Sprint(i)))
+	}
+	for i := 0; i < 5; i++ {
+		expire(r, "prod", "app", fmt.Sprint(i))
+	}
+
+	r.evict(time.Now())
+	if !r.preserving {
+		t.Fatal("did not enter self-preservation with half the leases expired")
+	}
+	if n := count(r, "prod", "app"); n != 10 {
+		t.Fatalf("evicted during self-preservation: %d instances left", n)
+	}
+
+	// 续约恢复，只剩一个实例过期
+	for i := 0; i < 4; i++ {
+		r.renew("prod", "app", fmt.Sprint(i))
+	}
+	r.evict(time.Now())
+	if r.preserving {
+		t.Fatal("did not leave self-preservation after renewals recovered")
+	}
+	if n := count(r, "prod", "app"); n != 9 {
+		t.Fatalf("instances after leaving self-preservation = %d, want 9", n)
+	}
+}
+
+func TestSelfPreservationDisabled(t *testing.T) {
+	r := newRegistry(testTTL, 0, 5)
+	for i := 0; i < 10; i++ {
+		r.register(newInstance("prod", "app", fmt.Sprint(i)))
+		expire(r, "prod", "app", fmt.Sprint(i))
+	}
+	r.evict(time.Now())
+	if _, ok := r.fetch("prod", "app", 0); ok || r.preserving {
+		t.Fatal("expired instances kept with self-preservation disabled")
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/zhangweijie11/zRPC/naming"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// replicationHeader 标记节点间同步的请求，收到后只在本地生效，不再向其他节点同步
+const replicationHeader = "X-Zrpc-Replication"
+
+const (
+	replicationQueueSize = 1024
+	replicationTimeout   = 5 * time.Second
+)
+
+// 待同步的写操作
+type replication struct {
+	path     string // 接口路径，与客户端请求的接口相同
+	instance *naming.Instance
+}
+
+// replicator 按顺序向一个节点同步写操作，节点不可用时丢弃，由服务的下一次续约修复
+type replicator struct {
+	peer   string
+	client *http.Client
+	queue  chan replication
+	done   chan struct{}
+}
+
+func newReplicator(peer string) *replicator {
+	rp := &replicator{
+		peer:   peer,
+		client: &http.Client{Timeout: replicationTimeout},
+		queue:  make(chan replication, replicationQueueSize),
+		done:   make(chan struct{}),
+	}
+	go rp.run()
+	return rp
+}
+
+// 加入同步队列，队列已满时丢弃
+func (rp *replicator) replicate(path string, instance *naming.Instance) {
+	select {
+	case rp.queue <- replication{path: path, instance: instance}:
+	default:
+		log.Printf("同步队列已满，丢弃同步请求, 节点: %s, 接口: %s\n", rp.peer, path)
+	}
+}
+
+func (rp *replicator) run() {
+	defer close(rp.done)
+	for r := range rp.queue {
+		code, err := rp.post(r.path, r.instance)
+		if err != nil {
+			log.Printf("同步出现异常, 节点: %s, 接口: %s, 错误: %v\n", rp.peer, r.path, err)
+			continue
+		}
+		// 节点上没有该实例时（如节点刚启动）补发注册
+		if r.path == renewPath && code == http.StatusNotFound {
+			code, err = rp.post(registerPath, r.instance)
+		}
+		if err == nil && code != http.StatusOK {
+			log.Printf("同步失败, 节点: %s, 接口: %s, 响应码: %d\n", rp.peer, r.path, code)
+		}
+	}
+}
+
+// 发送同步请求，返回响应中的状态码
+func (rp *replicator) post(path string, instance *naming.Instance) (int, error) {
+	body, err := json.Marshal(instance)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("http://%s%s", rp.peer, path), bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(replicationHeader, "true")
+	resp, err := rp.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	res := naming.Response{}
+	if err = json.Unmarshal(data, &res); err != nil {
+		return 0, err
+	}
+	return res.Code, nil
+}
+
+// 停止接收同步请求，等待已排队的请求发送完成
+func (rp *replicator) close() {
+	close(rp.queue)
+	<-rp.done
+}
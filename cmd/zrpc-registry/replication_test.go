@@ -0,0 +1,28 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 节点上没有续约的实例时，同步改为补发注册
+func TestReplicatorRegistersOnRenewNotFound(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	peer := &server{registry: newRegistry(testTTL, 0.85, 5)}
+	engine := gin.New()
+	peer.routes(engine)
+	httpServer := httptest.NewServer(engine)
+	defer httpServer.Close()
+
+	rp := newReplicator(nodeAddr(httpServer.URL))
+	rp.replicate(renewPath, newInstance("prod", "app", "a"))
+	// 关闭时等待已排队的同步完成
+	rp.close()
+
+	data, ok := peer.registry.fetch("prod", "app", 0)
+	if !ok || len(data.Instances) != 1 || data.Instances[0].Hostname != "a" {
+		t.Fatalf("peer instances after renew replication: %+v", data.Instances)
+	}
+}
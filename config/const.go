@@ -11,7 +11,3 @@ const (
 	CODEC_GOB CodecMode = iota
 	CODEC_JSON
 )
-
-const (
-	Protocol_MsgVersion = 1
-)
@@ -0,0 +1,41 @@
+package consumer
+
+import "sync"
+
+// 令牌桶容量，允许短时间内的少量突发
+const maxBudgetTokens = 10
+
+// tokenBudget 额外请求（对冲、重试）预算：每个正常请求存入 ratio 个令牌，每个额外请求消耗 1 个令牌，
+// 从而保证额外请求不会超过正常流量的一定比例
+type tokenBudget struct {
+	mutex  sync.Mutex
+	tokens float64
+	ratio  float64
+}
+
+func newTokenBudget(ratio float64) *tokenBudget {
+	return &tokenBudget{tokens: maxBudgetTokens, ratio: ratio}
+}
+
+// 正常请求存入令牌
+func (b *tokenBudget) deposit() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.tokens += b.ratio
+	if b.tokens > maxBudgetTokens {
+		b.tokens = maxBudgetTokens
+	}
+}
+
+// 额外请求取出令牌，令牌不足时返回 false
+func (b *tokenBudget) withdraw() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
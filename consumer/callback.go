@@ -0,0 +1,117 @@
+package consumer
+
+import (
+	"context"
+	"github.com/zhangweijie11/zRPC/global"
+	"github.com/zhangweijie11/zRPC/metadata"
+	"github.com/zhangweijie11/zRPC/protocol"
+	"github.com/zhangweijie11/zRPC/status"
+	"log"
+	"reflect"
+)
+
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+// RegisterCallback 注册回调服务，服务端处理本客户端的请求时，可通过 provider.CallbackFromContext
+// 获取句柄，在同一连接上调用回调服务的方法，仅 v2 连接支持。方法第一个参数为 context.Context 时
+// 自动传入携带服务端元数据的上下文，最后一个 error 类型的返回值作为调用错误
+func (cli *RPCClient) RegisterCallback(name string, class interface{}) {
+	cli.callbackMutex.Lock()
+	defer cli.callbackMutex.Unlock()
+
+	if cli.callbacks == nil {
+		cli.callbacks = make(map[string]reflect.Value)
+	}
+	cli.callbacks[name] = reflect.ValueOf(class)
+}
+
+// 处理服务端的回调请求并写回结果，单向回调不写回
+func (cli *RPCClient) handleCallback(conn *clientConn, msg *protocol.RPCMsg) {
+	defer msg.Release()
+
+	payload, err := cli.invokeCallback(msg)
+	if msg.Flags.Has(protocol.OneWay) {
+		if err != nil {
+			log.Printf("单向回调 %s.%s 失败：%v\n", msg.ServiceClass, msg.ServiceMethod, err)
+		}
+		return
+	}
+
+	resMsg := protocol.NewRPCMsg()
+	resMsg.SetVersion(msg.Version())
+	resMsg.SetCompressType(protocol.None)
+	resMsg.SetSerializeType(msg.SerializeType())
+	resMsg.RequestID = msg.RequestID
+	if err != nil {
+		resMsg.SetMsgType(protocol.Error)
+		resMsg.Payload = status.Convert(err).Marshal()
+	} else {
+		resMsg.SetMsgType(protocol.Response)
+		resMsg.Payload = payload
+	}
+	if err = conn.send(resMsg, cli.writeDeadline()); err != nil {
+		log.Printf("回调响应写出失败：%v\n", err)
+	}
+}
+
+// 解码参数、调用回调方法并编码结果，回调方法的 panic 转换为 Internal 错误
+func (cli *RPCClient) invokeCallback(msg *protocol.RPCMsg) (payload []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("回调 %s.%s 异常：%v\n", msg.ServiceClass, msg.ServiceMethod, r)
+			err = status.Errorf(status.Internal, "回调内部错误：%v", r)
+		}
+	}()
+
+	cli.callbackMutex.RLock()
+	class, ok := cli.callbacks[msg.ServiceClass]
+	cli.callbackMutex.RUnlock()
+	if !ok {
+		return nil, status.Errorf(status.NotFound, "回调服务 %s 不存在！", msg.ServiceClass)
+	}
+	method := class.MethodByName(msg.ServiceMethod)
+	if !method.IsValid() {
+		return nil, status.Errorf(status.NotFound, "回调方法 %s 不存在！", msg.ServiceMethod)
+	}
+	coder := global.Codecs[msg.SerializeType()]
+	if coder == nil {
+		return nil, status.Errorf(status.InvalidArgument, "不支持的序列化类型：%d", msg.SerializeType())
+	}
+	params := make([]interface{}, 0)
+	if err = coder.Decode(msg.Payload, &params); err != nil {
+		return nil, status.Errorf(status.InvalidArgument, "参数解码失败：%v", err)
+	}
+
+	methodType := method.Type()
+	args := make([]reflect.Value, 0, len(params)+1)
+	if methodType.NumIn() > 0 && methodType.In(0) == contextType {
+		ctx := context.Background()
+		if msg.Metadata != nil {
+			ctx = metadata.NewIncomingContext(ctx, msg.Metadata)
+		}
+		args = append(args, reflect.ValueOf(&ctx).Elem())
+	}
+	for i := range params {
+		args = append(args, reflect.ValueOf(params[i]))
+	}
+	if len(args) != methodType.NumIn() {
+		return nil, status.Errorf(status.InvalidArgument, "参数数量不一致：%d-%d", len(args), methodType.NumIn())
+	}
+
+	result := method.Call(args)
+	resArgs := make([]interface{}, len(result))
+	for i := range result {
+		resArgs[i] = result[i].Interface()
+	}
+	if numOut := len(result); numOut > 0 && methodType.Out(numOut-1) == errorType {
+		if callErr, ok := resArgs[numOut-1].(error); ok && callErr != nil {
+			return nil, callErr
+		}
+	}
+
+	payload, err = coder.Encode(resArgs)
+	if err != nil {
+		return nil, status.Errorf(status.Internal, "结果编码失败：%v", err)
+	}
+	return payload, nil
+}
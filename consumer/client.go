@@ -2,35 +2,54 @@ package consumer
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
-	"github.com/zhangweijie11/zRPC/config"
 	"github.com/zhangweijie11/zRPC/global"
+	"github.com/zhangweijie11/zRPC/metadata"
 	"github.com/zhangweijie11/zRPC/protocol"
+	"github.com/zhangweijie11/zRPC/status"
+	"github.com/zhangweijie11/zRPC/transport"
 	"log"
 	"net"
 	"reflect"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Client interface {
 	Connect(string) error
 	Invoke(context.Context, *Service, interface{}, ...interface{}) (interface{}, error)
+	Call(context.Context, *Service, []interface{}) ([]interface{}, error)
+	Notify(context.Context, *Service, []interface{}) error
+	NewStream(context.Context, *Service, []interface{}) (*ClientStream, error)
+	Use(...Interceptor)
 	Close()
 	MakeFunc(*Service, interface{})
 	GetAddr() string
+	IsDraining() bool
 }
 
 type Option struct {
-	Retries           int                    // 重试次数
+	Retries           int                    // 重试次数，未配置 RetryPolicy 时生效
 	ConnectionTimeout time.Duration          // 超时时间
 	ReadTimeout       time.Duration          // 超时时间
 	WriteTimeout      time.Duration          // 超时时间
 	SerializeType     protocol.SerializeType // 序列化协议
 	CompressType      protocol.CompressType  // 压缩类型
-	NetProtocol       string
+	NetProtocol       string                 // 传输协议，地址没有协议前缀且 Transport 为空时按该前缀选择内置的传输方式
+	Transport         transport.Transport    // 地址没有协议前缀时使用的传输方式
 	FailMode          FailMode
 	LoadBalanceMode   LoadBalanceMode
+	RetryPolicy       *RetryPolicy  // 重试策略
+	Hedge             *HedgePolicy  // 对冲请求策略，为空时不开启
+	ProtocolVersion   byte          // 支持的最高协议版本，0 表示 protocol.MaxVersion，连接时与服务端协商
+	WriteBatch        bool          // 开启合并写，同一连接上并发调用的帧由写协程合并后写出
+	WriteBatchDelay   time.Duration // 合并写时队列排空后继续等待更多帧的最长时间，0 表示立即写出
+	WriteBufferSize   int           // 合并写的缓冲区大小，0 表示使用默认值
+	StreamWindow      int           // 流式调用的接收窗口，即每个流最多缓冲的数据帧数，0 表示使用默认值
+	TLSConfig         *tls.Config   // TLS 配置，双向认证时需配置客户端证书；为空时只能连接明文地址
 }
 
 var DefaultOption = Option{
@@ -45,10 +64,22 @@ var DefaultOption = Option{
 	LoadBalanceMode:   RoundRobinBalance,
 }
 
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// 收到 GoAway 后，在该时间内认为服务端仍处于关闭流程，负载均衡时跳过
+const drainingPeriod = 10 * time.Second
+
 type RPCClient struct {
-	conn   net.Conn
-	option Option
-	addr   string
+	conn      *clientConn
+	option    Option
+	addr      string
+	mutex     sync.Mutex // 保护连接的建立与替换
+	drainedAt int64      // 最近一次收到 GoAway 的时间（UnixNano），重连成功后清零
+
+	interceptors []Interceptor
+
+	callbackMutex sync.RWMutex
+	callbacks     map[string]reflect.Value // 按服务名注册的回调服务
 }
 
 // NewClient 初始化客户端
@@ -58,46 +89,392 @@ func NewClient(option Option) *RPCClient {
 
 // Connect 连接客户端
 func (cli *RPCClient) Connect(addr string) error {
-	conn, err := net.DialTimeout(cli.option.NetProtocol, addr, cli.option.ConnectionTimeout)
+	cli.mutex.Lock()
+	defer cli.mutex.Unlock()
+
+	return cli.connect(addr)
+}
+
+func (cli *RPCClient) connect(addr string) error {
+	conn, version, err := cli.dial(addr)
 	if err != nil {
 		return err
 	}
 
-	cli.conn = conn
+	if cli.conn != nil {
+		// v2 连接上可能还有未完成的调用，等其结束后再关闭
+		cli.conn.closeWhenIdle()
+	}
+	var writer *protocol.BatchWriter
+	if cli.option.WriteBatch {
+		writer = protocol.NewBatchWriter(conn, protocol.BatchOption{
+			BufferSize:   cli.option.WriteBufferSize,
+			MaxDelay:     cli.option.WriteBatchDelay,
+			WriteTimeout: cli.option.WriteTimeout,
+		})
+	}
+	cli.conn = newClientConn(conn, version, writer, func() {
+		atomic.StoreInt64(&cli.drainedAt, time.Now().UnixNano())
+	}, cli.handleCallback)
 	cli.addr = addr
+	atomic.StoreInt64(&cli.drainedAt, 0)
 
 	return nil
 }
 
+// 建立连接并协商协议版本，只支持 v1 的服务端会拒绝握手，此时重新连接并按 v1 通信
+func (cli *RPCClient) dial(addr string) (net.Conn, byte, error) {
+	conn, err := cli.dialConn(addr)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	maxVersion := cli.option.ProtocolVersion
+	if maxVersion == 0 {
+		maxVersion = protocol.MaxVersion
+	}
+	if maxVersion < protocol.Version2 {
+		return conn, protocol.Version1, nil
+	}
+
+	version, err := handshake(conn, maxVersion, cli.option.ConnectionTimeout)
+	if err == nil {
+		return conn, version, nil
+	}
+	conn.Close()
+	if err != errHandshakeRejected {
+		return nil, 0, err
+	}
+	conn, err = cli.dialConn(addr)
+	if err != nil {
+		return nil, 0, err
+	}
+	return conn, protocol.Version1, nil
+}
+
+// 按地址的协议前缀选择传输方式，tls:// 及 unix+tls:// 等前缀使用 TLS；
+// 没有前缀时使用配置的传输方式，按是否配置了 TLSConfig 选择是否加密，以便服务发现得到的地址决定拨号方式
+func (cli *RPCClient) dialConn(addr string) (net.Conn, error) {
+	scheme, useTLS, address, ok := transport.ParseAddr(addr)
+	var trans transport.Transport
+	var err error
+	switch {
+	case ok:
+		trans, err = transport.Get(scheme)
+	case cli.option.Transport != nil:
+		trans, useTLS = cli.option.Transport, cli.option.TLSConfig != nil
+	case cli.option.NetProtocol == "":
+		trans, useTLS = transport.TCP{}, cli.option.TLSConfig != nil
+	default:
+		trans, err = transport.Get(cli.option.NetProtocol)
+		useTLS = cli.option.TLSConfig != nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if useTLS && cli.option.TLSConfig == nil {
+		return nil, fmt.Errorf("服务端 %s 要求 TLS 连接，未配置 TLSConfig！", address)
+	}
+
+	conn, err := trans.Dial(address, cli.option.ConnectionTimeout)
+	if err != nil || !useTLS {
+		return conn, err
+	}
+	config := cli.option.TLSConfig
+	if config.ServerName == "" && trans.Scheme() == transport.SchemeTCP {
+		// 未指定 ServerName 时按地址中的主机名校验服务端证书
+		config = config.Clone()
+		config.ServerName, _, _ = net.SplitHostPort(address)
+	}
+	tlsConn := tls.Client(conn, config)
+	ctx := context.Background()
+	if cli.option.ConnectionTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cli.option.ConnectionTimeout)
+		defer cancel()
+	}
+	if err = tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// IsDraining 服务端是否正在关闭，新请求应路由到其他服务端
+func (cli *RPCClient) IsDraining() bool {
+	drainedAt := atomic.LoadInt64(&cli.drainedAt)
+	return drainedAt != 0 && time.Since(time.Unix(0, drainedAt)) < drainingPeriod
+}
+
 // Invoke 执行
 func (cli *RPCClient) Invoke(ctx context.Context, service *Service, stub interface{}, params ...interface{}) (interface{}, error) {
-	cli.MakeFunc(service, stub)
-
-	return cli.wrapCall(ctx, stub, params...)
+	return invokeStub(stub, cli.stubInvoker(ctx, service, stub), params...)
 }
 
 // Close 关闭客户端
 func (cli *RPCClient) Close() {
+	cli.mutex.Lock()
+	defer cli.mutex.Unlock()
+
 	if cli.conn != nil {
 		cli.conn.Close()
+		cli.conn = nil
 	}
 }
 
 // MakeFunc 通过反射生成代理函数，在代理函数中完成网络连接、请求数据序列化、网络传输、响应返回数据解析等工作
 func (cli *RPCClient) MakeFunc(service *Service, methodPtr interface{}) {
-	container := reflect.ValueOf(methodPtr).Elem()
+	makeStub(methodPtr, cli.stubInvoker(context.Background(), service, methodPtr))
+}
+
+// 按函数类型选择代理函数的调用方式，没有返回值的函数作为单向调用
+func (cli *RPCClient) stubInvoker(ctx context.Context, service *Service, methodPtr interface{}) func([]interface{}) ([]interface{}, error) {
+	if isOneWay(methodPtr) {
+		return func(args []interface{}) ([]interface{}, error) {
+			return nil, cli.Notify(ctx, service, args)
+		}
+	}
+	return func(args []interface{}) ([]interface{}, error) {
+		return cli.Call(ctx, service, args)
+	}
+}
+
+// Use 注册拦截器，按注册顺序依次执行，需在发起调用前注册
+func (cli *RPCClient) Use(interceptors ...Interceptor) {
+	cli.interceptors = append(cli.interceptors, interceptors...)
+}
+
+// Call 经过拦截器链发起一次远程调用，返回解码后的结果
+func (cli *RPCClient) Call(ctx context.Context, service *Service, args []interface{}) ([]interface{}, error) {
+	return chainInterceptors(cli.interceptors, cli.call)(ctx, service, args)
+}
+
+// 实际的远程调用，连接断开或服务端关闭后会在下次调用时自动重连
+func (cli *RPCClient) call(ctx context.Context, service *Service, args []interface{}) ([]interface{}, error) {
+	conn, err := cli.getConn()
+	if err != nil {
+		return nil, err
+	}
+	if conn.version < protocol.Version2 {
+		conn.serial.Lock()
+		defer conn.serial.Unlock()
+	}
+
 	// 针对不同序列化协议的编解码器，默认为 GOB 协议
 	coder := global.Codecs[cli.option.SerializeType]
+	id, responses := conn.register()
+	defer conn.unregister(id)
+	msg, err := cli.newRequest(ctx, conn, id, service, args)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline, _ := ctx.Deadline()
+	err = conn.send(msg, deadline)
+	if err != nil {
+		log.Printf("发送数据出现异常：%v\n", err)
+		cli.dropConn(conn)
+		return nil, err
+	}
+
+	respMsg, err := conn.receive(responses, ctx.Done())
+	if err != nil {
+		cli.dropConn(conn)
+		return nil, err
+	}
+	if respMsg == nil {
+		if conn.version >= protocol.Version2 {
+			cli.cancelRequest(conn, id)
+		} else {
+			// v1 没有请求 ID，无法单独取消某次请求，只能关闭连接来中断调用
+			cli.dropConn(conn)
+		}
+		return nil, ctx.Err()
+	}
+	defer respMsg.Release()
+
+	if respMsg.MsgType() == protocol.GoAway {
+		// 服务端正在关闭，请求未被处理，可安全地重试到其他服务端
+		cli.dropConn(conn)
+		return nil, status.New(status.Unavailable, "服务端正在关闭，请求未处理！")
+	}
+	if respMsg.MsgType() == protocol.Error {
+		return nil, status.Unmarshal(respMsg.Payload)
+	}
+
+	respDecode := make([]interface{}, 0)
+	err = coder.Decode(respMsg.Payload, &respDecode)
+	if err != nil {
+		log.Printf("解码出现异常：%v\n", err)
+		return nil, err
+	}
+
+	return respDecode, nil
+}
+
+// Notify 经过拦截器链发起一次单向调用，请求写出后即返回，不等待服务端处理。
+// v1 连接不支持单向调用，按普通调用处理并忽略结果
+func (cli *RPCClient) Notify(ctx context.Context, service *Service, args []interface{}) error {
+	_, err := chainInterceptors(cli.interceptors, cli.notify)(ctx, service, args)
+	return err
+}
+
+func (cli *RPCClient) notify(ctx context.Context, service *Service, args []interface{}) ([]interface{}, error) {
+	conn, err := cli.getConn()
+	if err != nil {
+		return nil, err
+	}
+	if conn.version < protocol.Version2 {
+		_, err = cli.call(ctx, service, args)
+		return nil, err
+	}
+
+	// 单向调用没有响应，但仍需唯一的请求 ID，以便服务端区分处理中的请求
+	msg, err := cli.newRequest(ctx, conn, conn.nextRequestID(), service, args)
+	if err != nil {
+		return nil, err
+	}
+	msg.Flags |= protocol.OneWay
+
+	deadline, _ := ctx.Deadline()
+	if err = conn.send(msg, deadline); err != nil {
+		log.Printf("发送数据出现异常：%v\n", err)
+		cli.dropConn(conn)
+		return nil, err
+	}
+	return nil, nil
+}
+
+// NewStream 经过拦截器链发起服务端流式调用，返回接收结果的流，仅 v2 连接支持。
+// 流在 ctx 结束时取消
+func (cli *RPCClient) NewStream(ctx context.Context, service *Service, args []interface{}) (*ClientStream, error) {
+	result, err := chainInterceptors(cli.interceptors, cli.newStream)(ctx, service, args)
+	return streamResult(result, err)
+}
+
+func (cli *RPCClient) newStream(ctx context.Context, service *Service, args []interface{}) ([]interface{}, error) {
+	conn, err := cli.getConn()
+	if err != nil {
+		return nil, err
+	}
+	if conn.version < protocol.Version2 {
+		return nil, status.New(status.Unimplemented, "v1 协议不支持流式调用！")
+	}
+
+	stream := conn.addStream(func(id uint64) *protocol.Stream {
+		return protocol.NewClientStream(id, conn.version, cli.option.SerializeType, cli.option.StreamWindow,
+			func(frame *protocol.RPCMsg) error { return conn.send(frame, cli.writeDeadline()) })
+	})
+	msg, err := cli.newRequest(ctx, conn, stream.ID(), service, args)
+	if err != nil {
+		conn.removeStream(stream.ID())
+		return nil, err
+	}
+	msg.Flags |= protocol.Streaming
+
+	deadline, _ := ctx.Deadline()
+	if err = conn.send(msg, deadline); err == nil {
+		err = stream.Open()
+	}
+	if err != nil {
+		log.Printf("发送数据出现异常：%v\n", err)
+		conn.removeStream(stream.ID())
+		cli.dropConn(conn)
+		return nil, err
+	}
+
+	cs := &ClientStream{ctx: ctx, cli: cli, conn: conn, stream: stream}
+	go cs.watch()
+	return []interface{}{cs}, nil
+}
+
+// 按写超时计算的写截止时间，未配置写超时时不限制
+func (cli *RPCClient) writeDeadline() time.Time {
+	if cli.option.WriteTimeout > 0 {
+		return time.Now().Add(cli.option.WriteTimeout)
+	}
+	return time.Time{}
+}
+
+// 编码参数并初始化请求消息，v2 连接携带调用的元数据
+func (cli *RPCClient) newRequest(ctx context.Context, conn *clientConn, id uint64, service *Service, args []interface{}) (*protocol.RPCMsg, error) {
+	coder := global.Codecs[cli.option.SerializeType]
+	payload, err := coder.Encode(args)
+	if err != nil {
+		log.Printf("编码出现异常：%v\n", err)
+		return nil, err
+	}
+
+	msg := protocol.NewRPCMsg()
+	msg.SetVersion(conn.version)
+	msg.SetMsgType(protocol.Request)
+	msg.SetCompressType(cli.option.CompressType)
+	msg.SetSerializeType(cli.option.SerializeType)
+	msg.RequestID = id
+	msg.ServiceClass = service.Class
+	msg.ServiceMethod = service.Method
+	msg.Payload = payload
+	if md, ok := metadata.FromOutgoingContext(ctx); ok && conn.version >= protocol.Version2 {
+		msg.Metadata = md
+	}
+	return msg, nil
+}
+
+// 获取可用的连接，未连接或服务端正在关闭时重新连接
+func (cli *RPCClient) getConn() (*clientConn, error) {
+	cli.mutex.Lock()
+	defer cli.mutex.Unlock()
+
+	if cli.conn == nil || cli.conn.isDraining() {
+		if cli.addr == "" {
+			return nil, errors.New("客户端未连接！")
+		}
+		if err := cli.connect(cli.addr); err != nil {
+			return nil, err
+		}
+	}
+	return cli.conn, nil
+}
+
+// 通知服务端取消请求，服务端处理结束后的响应会被丢弃
+func (cli *RPCClient) cancelRequest(conn *clientConn, id uint64) {
+	msg := protocol.NewRPCMsg()
+	msg.SetVersion(conn.version)
+	msg.SetMsgType(protocol.Cancel)
+	msg.RequestID = id
+	if err := conn.send(msg, cli.writeDeadline()); err != nil {
+		cli.dropConn(conn)
+	}
+}
+
+// 丢弃不可用的连接，等待下次调用重连
+func (cli *RPCClient) dropConn(conn *clientConn) {
+	cli.mutex.Lock()
+	defer cli.mutex.Unlock()
+
+	conn.Close()
+	if cli.conn == conn {
+		cli.conn = nil
+	}
+}
+
+// 利用反射机制，根据函数类型信息动态创建代理函数，并设置到 methodPtr 指向的位置，
+// 代理函数负责参数与返回值的转换，实际的远程调用交给 invoke 完成
+func makeStub(methodPtr interface{}, invoke func([]interface{}) ([]interface{}, error)) {
+	container := reflect.ValueOf(methodPtr).Elem()
+	funcType := container.Type()
 
 	handler := func(req []reflect.Value) []reflect.Value {
 		// 函数类型的返回值数量
-		numOut := container.Type().NumOut()
+		numOut := funcType.NumOut()
 		errorHandler := func(err error) []reflect.Value {
 			outArgs := make([]reflect.Value, numOut)
 			for i := 0; i < len(outArgs); i++ {
-				outArgs[i] = reflect.Zero(container.Type().Out(i))
+				outArgs[i] = reflect.Zero(funcType.Out(i))
+			}
+			if numOut > 0 && funcType.Out(numOut-1) == errorType {
+				outArgs[numOut-1] = reflect.ValueOf(&err).Elem()
 			}
-			outArgs[len(outArgs)-1] = reflect.ValueOf(&err).Elem()
 			return outArgs
 		}
 
@@ -106,65 +483,49 @@ func (cli *RPCClient) MakeFunc(service *Service, methodPtr interface{}) {
 			inArgs = append(inArgs, arg.Interface())
 		}
 
-		payload, err := coder.Encode(inArgs)
-		if err != nil {
-			log.Printf("编码出现异常：%v\n", err)
-			return errorHandler(err)
-		}
-
-		msg := protocol.NewRPCMsg()
-		msg.SetVersion(config.Protocol_MsgVersion)
-		msg.SetMsgType(protocol.Request)
-		msg.SetCompressType(cli.option.CompressType)
-		msg.SetSerializeType(cli.option.SerializeType)
-		msg.ServiceClass = service.Class
-		msg.ServiceMethod = service.Method
-		msg.Payload = payload
-		err = msg.Send(cli.conn)
-		if err != nil {
-			log.Printf("发送数据出现异常：%v\n", err)
-			return errorHandler(err)
-		}
-
-		respMsg, err := protocol.Read(cli.conn)
+		respDecode, err := invoke(inArgs)
 		if err != nil {
 			return errorHandler(err)
 		}
 
-		respDecode := make([]interface{}, 0)
-		err = coder.Decode(respMsg.Payload, &respDecode)
-		if err != nil {
-			log.Printf("解码出现异常：%v\n", err)
-			return errorHandler(err)
-		}
-
-		if len(respDecode) == 0 {
-			respDecode = make([]interface{}, numOut)
-		}
-
 		outArgs := make([]reflect.Value, numOut)
 		for i := 0; i < numOut; i++ {
-			if i != numOut {
-				// 如果没有解码到值，设置为与函数返回类型对应位置相同类型的零值
-				if respDecode[i] == nil {
-					outArgs[i] = reflect.Zero(container.Type().Out(i))
-				} else {
-					outArgs[i] = reflect.ValueOf(respDecode[i])
-				}
+			// 如果没有解码到值，设置为与函数返回类型对应位置相同类型的零值
+			if i >= len(respDecode) || respDecode[i] == nil {
+				outArgs[i] = reflect.Zero(funcType.Out(i))
 			} else {
-				outArgs[i] = reflect.Zero(container.Type().Out(i))
+				outArgs[i] = reflect.ValueOf(respDecode[i])
 			}
 		}
 
 		return outArgs
 	}
-	// 利用反射机制，根据制定的函数类型信息以及处理函数 handler，动态创建一个函数，
-	// 并将这个新创建的函数设置到 container 对应的位置，覆盖原始的函数值或指针，实现动态生成的函数替换
-	container.Set(reflect.MakeFunc(container.Type(), handler))
+	container.Set(reflect.MakeFunc(funcType, handler))
 }
 
-// 执行实际函数调用
-func (cli *RPCClient) wrapCall(ctx context.Context, stub interface{}, params ...interface{}) (interface{}, error) {
+// 没有返回值的函数无法得到调用结果，自动作为单向调用
+func isOneWay(methodPtr interface{}) bool {
+	return reflect.TypeOf(methodPtr).Elem().NumOut() == 0
+}
+
+// 生成代理函数并执行调用。单向调用的函数没有 error 返回值，调用错误记录下来直接返回
+func invokeStub(stub interface{}, invoke func([]interface{}) ([]interface{}, error), params ...interface{}) (interface{}, error) {
+	var invokeErr error
+	makeStub(stub, func(args []interface{}) ([]interface{}, error) {
+		result, err := invoke(args)
+		invokeErr = err
+		return result, err
+	})
+
+	result, err := wrapCall(stub, params...)
+	if err == nil && isOneWay(stub) {
+		err = invokeErr
+	}
+	return result, err
+}
+
+// 执行实际函数调用，约定函数最后一个 error 类型的返回值作为调用错误返回
+func wrapCall(stub interface{}, params ...interface{}) (interface{}, error) {
 	f := reflect.ValueOf(stub).Elem()
 	// 判断参数的数量和函数定义的输入参数数量是否相同
 	if len(params) != f.Type().NumIn() {
@@ -177,6 +538,12 @@ func (cli *RPCClient) wrapCall(ctx context.Context, stub interface{}, params ...
 	}
 	result := f.Call(inArgs)
 
+	if numOut := len(result); numOut > 0 && f.Type().Out(numOut-1) == errorType {
+		if err, ok := result[numOut-1].Interface().(error); ok && err != nil {
+			return result, err
+		}
+	}
+
 	return result, nil
 }
 
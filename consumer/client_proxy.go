@@ -4,12 +4,14 @@ import (
 	"context"
 	"errors"
 	"github.com/zhangweijie11/zRPC/naming"
-	"strings"
 	"sync"
 )
 
 type ClientProxy interface {
 	Call(context.Context, string, interface{}, ...interface{}) (interface{}, error)
+	Notify(context.Context, string, ...interface{}) error
+	NewStream(context.Context, string, ...interface{}) (*ClientStream, error)
+	Use(...Interceptor)
 }
 
 type RPCClientProxy struct {
@@ -19,7 +21,12 @@ type RPCClientProxy struct {
 	mutex       sync.RWMutex
 	servers     []string
 	loadBalance LoadBalance
-	client      Client
+	clients     map[string]Client // 按服务地址缓存的客户端
+	retryPolicy *RetryPolicy
+	retryBudget *tokenBudget // 整个代理共享的重试预算
+	hedger      *hedger
+
+	interceptors []Interceptor
 }
 
 func (cp *RPCClientProxy) Call(ctx context.Context, servicePath string, stub interface{}, params ...interface{}) (interface{}, error) {
@@ -28,47 +35,115 @@ func (cp *RPCClientProxy) Call(ctx context.Context, servicePath string, stub int
 		return nil, err
 	}
 
-	err = cp.getConn()
-	// 如果获取链接出现问题，并且接受失败，直接返回
-	if err != nil && cp.failMode == Failfast {
+	invoke := cp.invoke
+	if isOneWay(stub) {
+		invoke = cp.notify
+	}
+	invoker := chainInterceptors(cp.interceptors, invoke)
+	return invokeStub(stub, func(args []interface{}) ([]interface{}, error) {
+		return invoker(ctx, service, args)
+	}, params...)
+}
+
+// Notify 经过拦截器链发起单向调用，请求写出后即返回。服务端可能已收到请求，因此不做重试
+func (cp *RPCClientProxy) Notify(ctx context.Context, servicePath string, args ...interface{}) error {
+	service, err := NewService(servicePath)
+	if err != nil {
+		return err
+	}
+
+	_, err = chainInterceptors(cp.interceptors, cp.notify)(ctx, service, args)
+	return err
+}
+
+func (cp *RPCClientProxy) notify(ctx context.Context, service *Service, args []interface{}) ([]interface{}, error) {
+	client, err := cp.getConn(cp.selectAddr())
+	if err != nil {
+		return nil, err
+	}
+	return nil, client.Notify(ctx, service, args)
+}
+
+// NewStream 经过拦截器链发起服务端流式调用，返回接收结果的流。流建立后不再重试
+func (cp *RPCClientProxy) NewStream(ctx context.Context, servicePath string, args ...interface{}) (*ClientStream, error) {
+	service, err := NewService(servicePath)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := chainInterceptors(cp.interceptors, cp.newStream)(ctx, service, args)
+	return streamResult(result, err)
+}
+
+func (cp *RPCClientProxy) newStream(ctx context.Context, service *Service, args []interface{}) ([]interface{}, error) {
+	client, err := cp.getConn(cp.selectAddr())
+	if err != nil {
 		return nil, err
 	}
+	stream, err := client.NewStream(ctx, service, args)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{stream}, nil
+}
+
+// Use 注册拦截器，包裹包含重试与对冲在内的整个调用，需在发起调用前注册
+func (cp *RPCClientProxy) Use(interceptors ...Interceptor) {
+	cp.interceptors = append(cp.interceptors, interceptors...)
+}
+
+// 按失败模式和重试策略执行调用
+func (cp *RPCClientProxy) invoke(ctx context.Context, service *Service, args []interface{}) ([]interface{}, error) {
+	policy := cp.retryPolicy.forMethod(service.Class + "." + service.Method)
+	maxAttempts := policy.MaxAttempts
+	if cp.failMode == Failfast || maxAttempts < 1 {
+		// 快速失败，不再重试
+		maxAttempts = 1
+	}
+	cp.retryBudget.deposit()
 
-	switch cp.failMode {
-	case Failretry:
-		retries := cp.option.Retries
-		for retries > 0 {
-			retries--
-			if cp.client != nil {
-				result, err := cp.client.Invoke(ctx, service, stub, params...)
-				if err == nil {
-					return result, err
-				}
+	addr := cp.selectAddr()
+	var lastErr error
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if attempt > 0 {
+			// 不可重试的错误或重试预算耗尽时直接返回，避免重试风暴压垮服务端
+			if !policy.retryable(lastErr) || !cp.retryBudget.withdraw() {
+				break
 			}
-		}
-	case Failover:
-		retries := cp.option.Retries
-		for retries > 0 {
-			retries--
-			if cp.client != nil {
-				result, err := cp.client.Invoke(ctx, service, stub, params...)
-				if err == nil {
-					return result, err
-				}
+			if err := sleepContext(ctx, policy.backoff(attempt)); err != nil {
+				break
 			}
-			err = cp.getConn()
-		}
-	case Failfast:
-		if cp.client != nil {
-			result, err := cp.client.Invoke(ctx, service, stub, params...)
-			if err == nil {
-				return result, nil
+			if cp.failMode == Failover {
+				// 故障转移，重新选择服务端
+				addr = cp.selectAddr()
 			}
-			return nil, err
 		}
+
+		result, err := cp.attempt(ctx, addr, service, args)
+		if err == nil {
+			return result, nil
+		}
+		lastErr = err
+	}
+
+	return nil, lastErr
+}
+
+// 单次调用，方法允许对冲时发起对冲请求
+func (cp *RPCClientProxy) attempt(ctx context.Context, addr string, service *Service, args []interface{}) ([]interface{}, error) {
+	if cp.hedger.enabled(service.Class + "." + service.Method) {
+		return cp.hedgedCall(ctx, addr, service, args)
 	}
+	return cp.callAddr(ctx, addr, service, args)
+}
 
-	return nil, errors.New("error")
+// 向指定服务端发起调用
+func (cp *RPCClientProxy) callAddr(ctx context.Context, addr string, service *Service, args []interface{}) ([]interface{}, error) {
+	client, err := cp.getConn(addr)
+	if err != nil {
+		return nil, err
+	}
+	return client.Call(ctx, service, args)
 }
 
 // 获取服务列表
@@ -85,7 +160,19 @@ func (cp *RPCClientProxy) discoveryService(ctx context.Context, appId string) ([
 }
 
 func NewRPCClientProxy(appId string, option Option, registry naming.Registry) ClientProxy {
-	rcp := &RPCClientProxy{option: option, failMode: option.FailMode, registry: registry}
+	retryPolicy := option.RetryPolicy
+	if retryPolicy == nil {
+		retryPolicy = defaultRetryPolicy(option.Retries)
+	}
+	rcp := &RPCClientProxy{
+		option:      option,
+		failMode:    option.FailMode,
+		registry:    registry,
+		clients:     make(map[string]Client),
+		retryPolicy: retryPolicy,
+		retryBudget: newTokenBudget(retryPolicy.BudgetRatio),
+		hedger:      newHedger(option.Hedge),
+	}
 	servers, err := rcp.discoveryService(context.Background(), appId)
 	if err != nil {
 		panic(err)
@@ -93,16 +180,63 @@ func NewRPCClientProxy(appId string, option Option, registry naming.Registry) Cl
 
 	rcp.servers = servers
 	rcp.loadBalance = LoadBalanceFactory(option.LoadBalanceMode, rcp.servers)
-	rcp.client = NewClient(rcp.option)
 
 	return rcp
 }
 
-func (cp *RPCClientProxy) getConn() error {
-	addr := strings.Replace(cp.loadBalance.Get(), cp.option.NetProtocol+"://", "", -1)
-	err := cp.client.Connect(addr) //长连接管理
+// 通过负载均衡选择服务端，跳过正在关闭的服务端，全部都在关闭时仍返回负载均衡的结果
+func (cp *RPCClientProxy) selectAddr() string {
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+
+	addr := cp.loadBalance.Get()
+	for i := 1; i < len(cp.servers) && cp.isDraining(addr); i++ {
+		addr = cp.loadBalance.Get()
+	}
+	return addr
+}
+
+// 选择一个不同于 addr 且未在关闭的服务端，没有其他服务端时返回空
+func (cp *RPCClientProxy) selectOtherAddr(addr string) string {
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+
+	for i := 0; i < len(cp.servers); i++ {
+		if other := cp.loadBalance.Get(); other != addr && !cp.isDraining(other) {
+			return other
+		}
+	}
+	return ""
+}
+
+// 服务端是否已通过 GoAway 通知正在关闭，需持有锁调用
+func (cp *RPCClientProxy) isDraining(addr string) bool {
+	client, ok := cp.clients[addr]
+	return ok && client.IsDraining()
+}
+
+// 获取服务端对应的客户端，长连接按地址复用
+func (cp *RPCClientProxy) getConn(addr string) (Client, error) {
+	cp.mutex.RLock()
+	client, ok := cp.clients[addr]
+	cp.mutex.RUnlock()
+	if ok {
+		return client, nil
+	}
+
+	client = NewClient(cp.option)
+	// 地址的协议前缀决定是否使用 TLS
+	err := client.Connect(addr)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+	if cached, ok := cp.clients[addr]; ok {
+		client.Close()
+		return cached, nil
 	}
-	return nil
+	cp.clients[addr] = client
+	return client, nil
 }
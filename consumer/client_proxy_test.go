@@ -0,0 +1,43 @@
+package consumer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/zhangweijie11/zRPC/naming"
+)
+
+// 单向调用的函数没有 error 返回值，连接失败时 Call 仍需返回错误
+func TestCallOneWayUnreachable(t *testing.T) {
+	registry := naming.NewStaticRegistry(map[string][]string{"app": {"127.0.0.1:1"}})
+	defer registry.Close()
+
+	option := DefaultOption
+	option.ConnectionTimeout = time.Second
+	proxy := NewRPCClientProxy("app", option, registry)
+
+	var notify func(string)
+	if _, err := proxy.Call(context.Background(), "app.Audit.Record", &notify, "event"); err == nil {
+		t.Fatal("one-way call to unreachable address returned nil error")
+	}
+	if err := proxy.Notify(context.Background(), "app.Audit.Record", "event"); err == nil {
+		t.Fatal("Notify to unreachable address returned nil error")
+	}
+}
+
+func TestInvokeOneWayUnreachable(t *testing.T) {
+	option := DefaultOption
+	option.ConnectionTimeout = time.Second
+	client := NewClient(option)
+	client.addr = "127.0.0.1:1"
+
+	service, err := NewService("app.Audit.Record")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var notify func(string)
+	if _, err := client.Invoke(context.Background(), service, &notify, "event"); err == nil {
+		t.Fatal("one-way Invoke to unreachable address returned nil error")
+	}
+}
@@ -0,0 +1,245 @@
+package consumer
+
+import (
+	"bufio"
+	"errors"
+	"github.com/zhangweijie11/zRPC/protocol"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// clientConn 客户端连接，由读协程持续接收服务端消息，以便及时感知服务端发送的 GoAway。
+// v2 连接按请求 ID 将响应分发给对应的调用，多个调用可以并发；v1 连接上的调用需通过 serial 串行
+type clientConn struct {
+	net.Conn
+	version    byte                  // 协商的协议版本
+	serial     sync.Mutex            // v1 连接上的调用串行执行
+	writer     *protocol.BatchWriter // 合并写，未开启时为 nil
+	writeMutex sync.Mutex
+
+	mutex   sync.Mutex
+	pending map[uint64]chan *protocol.RPCMsg // 等待响应的调用，按请求 ID 索引，v1 请求 ID 均为 0
+	streams map[uint64]*protocol.Stream      // 进行中的流，按请求 ID 索引
+	nextID  uint64
+	closing bool // 连接已被替换，等待中的调用全部结束后关闭
+
+	done     chan struct{} // 读协程退出时关闭
+	err      error         // 读协程退出的原因，done 关闭后可读
+	draining int32         // 是否已收到 GoAway
+}
+
+// onGoAway 在收到 GoAway 时调用；onRequest 在新协程中处理服务端发来的回调请求
+func newClientConn(conn net.Conn, version byte, writer *protocol.BatchWriter, onGoAway func(), onRequest func(*clientConn, *protocol.RPCMsg)) *clientConn {
+	cc := &clientConn{
+		Conn:    conn,
+		version: version,
+		writer:  writer,
+		pending: make(map[uint64]chan *protocol.RPCMsg),
+		streams: make(map[uint64]*protocol.Stream),
+		done:    make(chan struct{}),
+	}
+	go cc.readLoop(onGoAway, onRequest)
+	return cc
+}
+
+func (cc *clientConn) readLoop(onGoAway func(), onRequest func(*clientConn, *protocol.RPCMsg)) {
+	defer close(cc.done)
+	defer cc.closeStreams()
+	if cc.writer != nil {
+		defer cc.writer.Close()
+	}
+	// 缓冲读取，连续到达的多帧只需一次系统调用
+	reader := bufio.NewReader(cc.Conn)
+	for {
+		msg, err := protocol.Read(reader)
+		if err != nil {
+			cc.err = err
+			return
+		}
+		if msg == nil {
+			cc.err = io.EOF
+			return
+		}
+
+		if msg.MsgType() == protocol.GoAway {
+			atomic.StoreInt32(&cc.draining, 1)
+			onGoAway()
+			// v2 服务端会处理完已收到的请求，等待中的调用继续等待各自的响应
+			if msg.Version() >= protocol.Version2 {
+				continue
+			}
+			// v1 服务端只会在没有处理中的请求时发送 GoAway，此时等待中的请求未被处理，同样交给调用方
+		}
+		if msg.MsgType() == protocol.Request {
+			// 服务端的回调请求，请求 ID 由服务端分配，与本端的请求 ID 相互独立
+			go onRequest(cc, msg)
+			continue
+		}
+
+		cc.mutex.Lock()
+		stream := cc.streams[msg.RequestID]
+		ch, ok := cc.pending[msg.RequestID]
+		cc.mutex.Unlock()
+		if stream != nil {
+			// 服务端拒绝流式请求时返回错误响应，与错误帧一样结束流
+			if err := stream.Deliver(msg); err != nil {
+				stream.Close(err)
+			}
+			continue
+		}
+		if !ok {
+			// 没有等待中的请求，丢弃
+			continue
+		}
+		select {
+		case ch <- msg:
+		default:
+		}
+	}
+}
+
+// 连接是否已收到 GoAway，不能再发送新请求
+func (cc *clientConn) isDraining() bool {
+	return atomic.LoadInt32(&cc.draining) == 1
+}
+
+// 登记一次调用，返回分配的请求 ID 及接收响应的通道
+func (cc *clientConn) register() (uint64, chan *protocol.RPCMsg) {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	var id uint64
+	if cc.version >= protocol.Version2 {
+		cc.nextID++
+		id = cc.nextID
+	}
+	ch := make(chan *protocol.RPCMsg, 1)
+	cc.pending[id] = ch
+	return id, ch
+}
+
+// 分配不需要等待响应的请求 ID
+func (cc *clientConn) nextRequestID() uint64 {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	cc.nextID++
+	return cc.nextID
+}
+
+// 登记一个流，分配请求 ID
+func (cc *clientConn) addStream(newStream func(id uint64) *protocol.Stream) *protocol.Stream {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	cc.nextID++
+	stream := newStream(cc.nextID)
+	cc.streams[stream.ID()] = stream
+	return stream
+}
+
+// 流结束，连接已被替换且没有进行中的调用时关闭连接
+func (cc *clientConn) removeStream(id uint64) {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	delete(cc.streams, id)
+	if cc.closing && len(cc.pending) == 0 && len(cc.streams) == 0 {
+		cc.Conn.Close()
+	}
+}
+
+// 连接断开，关闭所有进行中的流
+func (cc *clientConn) closeStreams() {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	for _, stream := range cc.streams {
+		stream.Close(cc.err)
+	}
+}
+
+// 调用结束，连接已被替换且没有等待中的调用时关闭连接
+func (cc *clientConn) unregister(id uint64) {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	delete(cc.pending, id)
+	if cc.closing && len(cc.pending) == 0 && len(cc.streams) == 0 {
+		cc.Conn.Close()
+	}
+}
+
+// 连接已被替换，不再发起新调用，等待中的调用结束后关闭
+func (cc *clientConn) closeWhenIdle() {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	cc.closing = true
+	if len(cc.pending) == 0 && len(cc.streams) == 0 {
+		cc.Conn.Close()
+	}
+}
+
+// 发送一条消息，同一连接上的写入互斥。开启合并写时交给写协程，按配置的写超时写出
+func (cc *clientConn) send(msg *protocol.RPCMsg, deadline time.Time) error {
+	if cc.writer != nil {
+		return cc.writer.Write(msg)
+	}
+
+	cc.writeMutex.Lock()
+	defer cc.writeMutex.Unlock()
+
+	cc.Conn.SetWriteDeadline(deadline)
+	return msg.Send(cc.Conn)
+}
+
+// 等待请求对应的响应，连接断开时返回错误，cancel 关闭时返回 nil
+func (cc *clientConn) receive(ch chan *protocol.RPCMsg, cancel <-chan struct{}) (*protocol.RPCMsg, error) {
+	select {
+	case msg := <-ch:
+		return msg, nil
+	case <-cc.done:
+		// 读协程可能在退出前刚收到响应
+		select {
+		case msg := <-ch:
+			return msg, nil
+		default:
+			return nil, cc.err
+		}
+	case <-cancel:
+		return nil, nil
+	}
+}
+
+var errHandshakeRejected = errors.New("服务端不支持版本协商！")
+
+// 与服务端协商协议版本。服务端返回错误响应说明其只支持 v1；
+// 未收到回复时返回 errHandshakeRejected，需重新连接后按 v1 通信
+func handshake(conn net.Conn, maxVersion byte, timeout time.Duration) (byte, error) {
+	if timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	err := protocol.NewHandshake(protocol.SupportedVersions(maxVersion)).Send(conn)
+	if err != nil {
+		return 0, err
+	}
+	reply, err := protocol.Read(conn)
+	if err != nil {
+		return 0, errHandshakeRejected
+	}
+
+	if reply.MsgType() != protocol.Handshake || len(reply.Payload) != 1 {
+		return protocol.Version1, nil
+	}
+	version := reply.Payload[0]
+	if version < protocol.Version1 || version > maxVersion {
+		return 0, protocol.ErrUnsupportedVersion
+	}
+	return version, nil
+}
@@ -0,0 +1,165 @@
+package consumer
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	latencyWindowSize = 128 // 每个方法保留的耗时样本数
+	minLatencySamples = 20  // 按分位计算对冲延迟所需的最少样本数
+)
+
+// HedgePolicy 对冲请求策略：请求在对冲延迟内未返回时，向另一个服务端再发一次请求，取先返回的结果。
+// 只应对幂等方法开启
+type HedgePolicy struct {
+	Methods     []string      // 允许对冲的方法，格式为 Class.Method
+	Percentile  float64       // 以该分位的历史耗时作为对冲延迟，如 0.95，为 0 时使用 Delay
+	Delay       time.Duration // 固定对冲延迟，历史样本不足时同样使用该值；不大于 0 时在样本足够前不对冲
+	BudgetRatio float64       // 对冲请求占正常请求的最大比例，如 0.1 表示最多 10%
+}
+
+type hedger struct {
+	policy    HedgePolicy
+	methods   map[string]struct{}
+	budget    *tokenBudget
+	mutex     sync.Mutex
+	latencies map[string]*latencyWindow
+}
+
+func newHedger(policy *HedgePolicy) *hedger {
+	if policy == nil {
+		return nil
+	}
+	methods := make(map[string]struct{}, len(policy.Methods))
+	for _, method := range policy.Methods {
+		methods[method] = struct{}{}
+	}
+	return &hedger{
+		policy:    *policy,
+		methods:   methods,
+		budget:    newTokenBudget(policy.BudgetRatio),
+		latencies: make(map[string]*latencyWindow),
+	}
+}
+
+// 方法是否允许对冲
+func (h *hedger) enabled(method string) bool {
+	if h == nil {
+		return false
+	}
+	_, ok := h.methods[method]
+	return ok
+}
+
+// 计算对冲延迟，没有可用的延迟时返回 false，本次调用不对冲。
+// 避免启动时样本不足且未配置 Delay 的情况下每个请求都立即对冲，使服务端负载翻倍
+func (h *hedger) delay(method string) (time.Duration, bool) {
+	if h.policy.Percentile > 0 {
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+
+		if window, ok := h.latencies[method]; ok && len(window.samples) >= minLatencySamples {
+			return window.percentile(h.policy.Percentile), true
+		}
+	}
+	return h.policy.Delay, h.policy.Delay > 0
+}
+
+// 记录一次成功调用的耗时
+func (h *hedger) observe(method string, latency time.Duration) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	window, ok := h.latencies[method]
+	if !ok {
+		window = &latencyWindow{}
+		h.latencies[method] = window
+	}
+	window.add(latency)
+}
+
+// latencyWindow 固定大小的耗时样本环形缓冲
+type latencyWindow struct {
+	samples []time.Duration
+	next    int
+}
+
+func (w *latencyWindow) add(latency time.Duration) {
+	if len(w.samples) < latencyWindowSize {
+		w.samples = append(w.samples, latency)
+		return
+	}
+	w.samples[w.next] = latency
+	w.next = (w.next + 1) % latencyWindowSize
+}
+
+func (w *latencyWindow) percentile(p float64) time.Duration {
+	sorted := make([]time.Duration, len(w.samples))
+	copy(sorted, w.samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	idx := int(p * float64(len(sorted)))
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
+
+type hedgeResult struct {
+	result  []interface{}
+	err     error
+	latency time.Duration
+}
+
+// 对冲调用：先向 addr 发起请求，超过对冲延迟仍未返回且预算充足时，向另一个服务端再发一次，
+// 取先成功的结果，返回时取消另一路仍在进行的请求
+func (cp *RPCClientProxy) hedgedCall(ctx context.Context, addr string, service *Service, args []interface{}) ([]interface{}, error) {
+	method := service.Class + "." + service.Method
+	cp.hedger.budget.deposit()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan hedgeResult, 2)
+	launch := func(addr string) {
+		go func() {
+			start := time.Now()
+			result, err := cp.callAddr(ctx, addr, service, args)
+			results <- hedgeResult{result: result, err: err, latency: time.Since(start)}
+		}()
+	}
+
+	launch(addr)
+	pending := 1
+	// 没有可用的对冲延迟时只等待第一路请求，成功的耗时仍作为样本记录
+	var hedge <-chan time.Time
+	if delay, ok := cp.hedger.delay(method); ok {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		hedge = timer.C
+	}
+
+	var err error
+	for pending > 0 {
+		select {
+		case <-hedge:
+			other := cp.selectOtherAddr(addr)
+			if other != "" && cp.hedger.budget.withdraw() {
+				launch(other)
+				pending++
+			}
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				cp.hedger.observe(method, res.latency)
+				return res.result, nil
+			}
+			err = res.err
+		}
+	}
+
+	return nil, err
+}
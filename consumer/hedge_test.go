@@ -0,0 +1,27 @@
+package consumer
+
+import (
+	"testing"
+	"time"
+)
+
+// 未配置 Delay 时，样本不足前不对冲，样本足够后按分位计算延迟
+func TestHedgeDelayWithoutSamples(t *testing.T) {
+	h := newHedger(&HedgePolicy{Methods: []string{"User.Get"}, Percentile: 0.9})
+	if delay, ok := h.delay("User.Get"); ok {
+		t.Fatalf("hedging enabled with no samples and no Delay: delay %v", delay)
+	}
+
+	for i := 1; i <= minLatencySamples; i++ {
+		h.observe("User.Get", time.Duration(i)*time.Millisecond)
+	}
+	delay, ok := h.delay("User.Get")
+	if !ok || delay != 19*time.Millisecond {
+		t.Fatalf("got delay %v, %v; want 19ms, true", delay, ok)
+	}
+
+	h = newHedger(&HedgePolicy{Methods: []string{"User.Get"}, Percentile: 0.9, Delay: 5 * time.Millisecond})
+	if delay, ok := h.delay("User.Get"); !ok || delay != 5*time.Millisecond {
+		t.Fatalf("got delay %v, %v; want fallback 5ms, true", delay, ok)
+	}
+}
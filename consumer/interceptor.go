@@ -0,0 +1,21 @@
+package consumer
+
+import "context"
+
+// Invoker 执行一次远程调用
+type Invoker func(ctx context.Context, service *Service, args []interface{}) ([]interface{}, error)
+
+// Interceptor 客户端拦截器，可在调用前后加入日志、监控、鉴权、参数校验等逻辑，
+// 调用 invoker 继续执行调用链，不调用则直接中断
+type Interceptor func(ctx context.Context, service *Service, args []interface{}, invoker Invoker) ([]interface{}, error)
+
+// 按注册顺序组合拦截器，先注册的拦截器位于外层
+func chainInterceptors(interceptors []Interceptor, invoker Invoker) Invoker {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], invoker
+		invoker = func(ctx context.Context, service *Service, args []interface{}) ([]interface{}, error) {
+			return interceptor(ctx, service, args, next)
+		}
+	}
+	return invoker
+}
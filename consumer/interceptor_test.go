@@ -0,0 +1,58 @@
+package consumer
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// 先注册的拦截器位于外层：进入时先执行，返回时后执行
+func TestChainInterceptorsOrder(t *testing.T) {
+	var trace []string
+	record := func(name string) Interceptor {
+		return func(ctx context.Context, service *Service, args []interface{}, invoker Invoker) ([]interface{}, error) {
+			trace = append(trace, name+" before")
+			result, err := invoker(ctx, service, args)
+			trace = append(trace, name+" after")
+			return result, err
+		}
+	}
+	invoker := func(ctx context.Context, service *Service, args []interface{}) ([]interface{}, error) {
+		trace = append(trace, "call")
+		return []interface{}{"ok"}, nil
+	}
+
+	chain := chainInterceptors([]Interceptor{record("a"), record("b"), record("c")}, invoker)
+	result, err := chain(context.Background(), &Service{Class: "User", Method: "Get"}, nil)
+	if err != nil || len(result) != 1 || result[0] != "ok" {
+		t.Fatalf("chain = %v, %v", result, err)
+	}
+	want := []string{"a before", "b before", "c before", "call", "c after", "b after", "a after"}
+	if !reflect.DeepEqual(trace, want) {
+		t.Fatalf("trace = %v, want %v", trace, want)
+	}
+}
+
+// 不调用 invoker 的拦截器中断调用链，内层拦截器及调用均不执行
+func TestChainInterceptorsShortCircuit(t *testing.T) {
+	called := false
+	stop := func(ctx context.Context, service *Service, args []interface{}, invoker Invoker) ([]interface{}, error) {
+		return []interface{}{"cached"}, nil
+	}
+	inner := func(ctx context.Context, service *Service, args []interface{}, invoker Invoker) ([]interface{}, error) {
+		called = true
+		return invoker(ctx, service, args)
+	}
+	invoker := func(ctx context.Context, service *Service, args []interface{}) ([]interface{}, error) {
+		called = true
+		return nil, nil
+	}
+
+	result, err := chainInterceptors([]Interceptor{stop, inner}, invoker)(context.Background(), &Service{}, nil)
+	if err != nil || len(result) != 1 || result[0] != "cached" {
+		t.Fatalf("chain = %v, %v", result, err)
+	}
+	if called {
+		t.Fatal("inner interceptor or invoker ran after a short circuit")
+	}
+}
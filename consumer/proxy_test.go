@@ -0,0 +1,260 @@
+package consumer_test
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zhangweijie11/zRPC/consumer"
+	"github.com/zhangweijie11/zRPC/protocol"
+	"github.com/zhangweijie11/zRPC/provider"
+	"github.com/zhangweijie11/zRPC/status"
+	"github.com/zhangweijie11/zRPC/zrpctest"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// Echo 返回所在服务端的名称，处理前等待 delay，调用方取消时提前结束
+type Echo struct {
+	name  string
+	delay time.Duration
+
+	mutex    sync.Mutex
+	requests int // 服务端收到的请求数，包括被注入的故障拦截的请求
+	calls    int
+	canceled int
+}
+
+func (e *Echo) Get(ctx context.Context) (string, error) {
+	e.mutex.Lock()
+	e.calls++
+	e.mutex.Unlock()
+	select {
+	case <-time.After(e.delay):
+		return e.name, nil
+	case <-ctx.Done():
+		e.mutex.Lock()
+		e.canceled++
+		e.mutex.Unlock()
+		return "", ctx.Err()
+	}
+}
+
+func (e *Echo) counts() (calls, canceled int) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.calls, e.canceled
+}
+
+func (e *Echo) requestCount() int {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.requests
+}
+
+// 读取请求后计数，先于故障注入的拦截器执行
+type requestCounter struct {
+	echo *Echo
+}
+
+func (rc requestCounter) AfterRead(msg *protocol.RPCMsg, err error) error {
+	if err == nil && msg != nil && msg.MsgType() == protocol.Request {
+		rc.echo.mutex.Lock()
+		rc.echo.requests++
+		rc.echo.mutex.Unlock()
+	}
+	return nil
+}
+
+// 在同一注册中心上启动多个服务，客户端代理可发现所有服务
+func startEchos(t *testing.T, echos ...*Echo) []*zrpctest.Server {
+	registry := zrpctest.NewRegistry()
+	var servers []*zrpctest.Server
+	for _, echo := range echos {
+		echo := echo
+		srv := zrpctest.NewServer(zrpctest.Config{Registry: registry}, func(rs *provider.RPCServer) {
+			rs.AddPlugin(requestCounter{echo})
+			rs.RegisterName("Echo", echo)
+		})
+		t.Cleanup(srv.Close)
+		servers = append(servers, srv)
+	}
+	return servers
+}
+
+func callEcho(ctx context.Context, proxy consumer.ClientProxy) (string, error) {
+	var get func() (string, error)
+	result, err := proxy.Call(ctx, zrpctest.DefaultAppID+".Echo.Get", &get)
+	if err != nil {
+		return "", err
+	}
+	return result.([]reflect.Value)[0].String(), nil
+}
+
+// 等待计数达到 want，超时返回最后一次的值
+func waitCount(want int, count func() int) int {
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		n := count()
+		if n >= want || time.Now().After(deadline) {
+			return n
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// 先返回的一路结果胜出，另一路请求被取消，取消帧送达服务端
+func TestHedgeFirstResponseWins(t *testing.T) {
+	slow := &Echo{name: "slow", delay: 5 * time.Second}
+	fast := &Echo{name: "fast"}
+	servers := startEchos(t, slow, fast)
+
+	option := consumer.DefaultOption
+	option.Hedge = &consumer.HedgePolicy{Methods: []string{"Echo.Get"}, Delay: 20 * time.Millisecond, BudgetRatio: 1}
+	proxy := servers[0].Client(option)
+
+	// 轮询负载均衡下两次调用中至少一次先发往慢的服务端
+	for i := 0; i < 2; i++ {
+		start := time.Now()
+		got, err := callEcho(context.Background(), proxy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != "fast" {
+			t.Fatalf("call %d answered by %q, want fast", i, got)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("call %d took %v, waited for the slow attempt", i, elapsed)
+		}
+	}
+	calls, _ := slow.counts()
+	if calls == 0 {
+		t.Fatal("slow server never received a request")
+	}
+	canceled := waitCount(calls, func() int { _, n := slow.counts(); return n })
+	if canceled != calls {
+		t.Fatalf("slow server canceled %d of %d attempts", canceled, calls)
+	}
+}
+
+// 预算耗尽后不再对冲
+func TestHedgeStopsWhenBudgetExhausted(t *testing.T) {
+	a := &Echo{name: "a", delay: 50 * time.Millisecond}
+	b := &Echo{name: "b", delay: 50 * time.Millisecond}
+	servers := startEchos(t, a, b)
+
+	option := consumer.DefaultOption
+	// 预算比例为 0 时只能使用初始的令牌
+	option.Hedge = &consumer.HedgePolicy{Methods: []string{"Echo.Get"}, Delay: 10 * time.Millisecond}
+	proxy := servers[0].Client(option)
+
+	const calls, budget = 15, 10
+	for i := 0; i < calls; i++ {
+		if _, err := callEcho(context.Background(), proxy); err != nil {
+			t.Fatal(err)
+		}
+	}
+	total := func() int {
+		callsA, _ := a.counts()
+		callsB, _ := b.counts()
+		return callsA + callsB
+	}
+	if n := waitCount(calls+budget, total); n != calls+budget {
+		t.Fatalf("servers received %d requests, want %d calls plus %d hedges", n, calls, budget)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := total(); n != calls+budget {
+		t.Fatalf("servers received %d requests after the budget ran out, want %d", n, calls+budget)
+	}
+}
+
+func retryOption(policy *consumer.RetryPolicy) consumer.Option {
+	option := consumer.DefaultOption
+	option.RetryPolicy = policy
+	return option
+}
+
+// 可重试的错误在次数内重试，不可重试的错误直接返回
+func TestRetryableCodes(t *testing.T) {
+	echo := &Echo{name: "echo"}
+	servers := startEchos(t, echo)
+	proxy := servers[0].Client(retryOption(&consumer.RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		RetryableCodes: []status.Code{status.Unavailable},
+		BudgetRatio:    1,
+	}))
+
+	servers[0].Faults.Set(zrpctest.Fault{Err: status.New(status.InvalidArgument, "bad request")})
+	if _, err := callEcho(context.Background(), proxy); status.CodeOf(err) != status.InvalidArgument {
+		t.Fatalf("got %v, want InvalidArgument", err)
+	}
+	if n := echo.requestCount(); n != 1 {
+		t.Fatalf("non-retryable error sent %d requests, want 1", n)
+	}
+
+	servers[0].Faults.Set(zrpctest.Fault{Err: status.New(status.Unavailable, "overloaded"), Times: 2})
+	if got, err := callEcho(context.Background(), proxy); err != nil || got != "echo" {
+		t.Fatalf("got %q, %v after two retryable failures", got, err)
+	}
+	if n := echo.requestCount(); n != 1+3 {
+		t.Fatalf("retryable errors sent %d requests, want 3", n-1)
+	}
+}
+
+// 共享的重试预算耗尽后不再重试
+func TestRetryBudgetExhausted(t *testing.T) {
+	echo := &Echo{name: "echo"}
+	servers := startEchos(t, echo)
+	// 预算比例为 0 时只能使用初始的令牌
+	proxy := servers[0].Client(retryOption(&consumer.RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: time.Millisecond,
+		RetryableCodes: []status.Code{status.Unavailable},
+	}))
+	servers[0].Faults.Set(zrpctest.Fault{Err: status.New(status.Unavailable, "down")})
+
+	const calls, budget = 6, 10
+	for i := 0; i < calls; i++ {
+		if _, err := callEcho(context.Background(), proxy); status.CodeOf(err) != status.Unavailable {
+			t.Fatalf("call %d: got %v, want Unavailable", i, err)
+		}
+	}
+	if n := echo.requestCount(); n != calls+budget {
+		t.Fatalf("servers received %d requests, want %d calls plus %d retries", n, calls, budget)
+	}
+}
+
+// 退避等待期间调用方取消时结束重试
+func TestRetryCanceledDuringBackoff(t *testing.T) {
+	echo := &Echo{name: "echo"}
+	servers := startEchos(t, echo)
+	proxy := servers[0].Client(retryOption(&consumer.RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 5 * time.Second,
+		RetryableCodes: []status.Code{status.Unavailable},
+		BudgetRatio:    1,
+	}))
+	servers[0].Faults.Set(zrpctest.Fault{Err: status.New(status.Unavailable, "down")})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := callEcho(ctx, proxy); err == nil {
+		t.Fatal("call succeeded with the server down")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("call returned after %v, backoff not interrupted", elapsed)
+	}
+	if n := echo.requestCount(); n != 1 {
+		t.Fatalf("server received %d requests, want 1", n)
+	}
+}
@@ -0,0 +1,88 @@
+package consumer
+
+import (
+	"context"
+	"github.com/zhangweijie11/zRPC/status"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy 重试策略，重试间隔按指数退避增长
+type RetryPolicy struct {
+	MaxAttempts    int                     // 最大尝试次数，包含首次调用
+	InitialBackoff time.Duration           // 首次重试前的等待时间
+	MaxBackoff     time.Duration           // 等待时间上限
+	Multiplier     float64                 // 每次重试等待时间的增长倍数，小于 1 时按 1 处理
+	Jitter         float64                 // 等待时间的随机抖动比例，如 0.2 表示上下浮动 20%
+	RetryableCodes []status.Code           // 可重试的错误码
+	BudgetRatio    float64                 // 重试请求占正常请求的最大比例，仅顶层策略生效
+	Methods        map[string]*RetryPolicy // 按方法（Class.Method）覆盖的策略
+}
+
+// 未配置 RetryPolicy 时，按 Option.Retries 生成的默认策略
+func defaultRetryPolicy(retries int) *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    retries,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+		RetryableCodes: []status.Code{status.Unavailable},
+		BudgetRatio:    0.1,
+	}
+}
+
+// 获取方法对应的策略
+func (p *RetryPolicy) forMethod(method string) *RetryPolicy {
+	if policy, ok := p.Methods[method]; ok && policy != nil {
+		return policy
+	}
+	return p
+}
+
+// 错误是否可重试
+func (p *RetryPolicy) retryable(err error) bool {
+	code := status.CodeOf(err)
+	for _, retryableCode := range p.RetryableCodes {
+		if code == retryableCode {
+			return true
+		}
+	}
+	return false
+}
+
+// 第 retry 次重试前的等待时间
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		// 未配置时等待时间保持不变，避免从第二次重试起不再等待
+		multiplier = 1
+	}
+	backoff := float64(p.InitialBackoff)
+	for i := 1; i < retry; i++ {
+		backoff *= multiplier
+	}
+	if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		backoff *= 1 + p.Jitter*(rand.Float64()*2-1)
+	}
+	return time.Duration(backoff)
+}
+
+// 等待指定时间，上下文结束时提前返回
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
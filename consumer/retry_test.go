@@ -0,0 +1,24 @@
+package consumer
+
+import (
+	"testing"
+	"time"
+)
+
+// 未配置 Multiplier 时每次重试的等待时间保持为 InitialBackoff
+func TestBackoffZeroMultiplier(t *testing.T) {
+	policy := &RetryPolicy{InitialBackoff: 50 * time.Millisecond}
+	for retry := 1; retry <= 3; retry++ {
+		if got := policy.backoff(retry); got != 50*time.Millisecond {
+			t.Fatalf("backoff(%d) = %v, want 50ms", retry, got)
+		}
+	}
+
+	policy = &RetryPolicy{InitialBackoff: 50 * time.Millisecond, Multiplier: 2, MaxBackoff: 150 * time.Millisecond}
+	want := []time.Duration{50 * time.Millisecond, 100 * time.Millisecond, 150 * time.Millisecond}
+	for i, w := range want {
+		if got := policy.backoff(i + 1); got != w {
+			t.Fatalf("backoff(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+}
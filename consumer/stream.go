@@ -0,0 +1,211 @@
+package consumer
+
+import (
+	"context"
+	"github.com/zhangweijie11/zRPC/global"
+	"github.com/zhangweijie11/zRPC/protocol"
+	"github.com/zhangweijie11/zRPC/status"
+	"io"
+	"log"
+	"sync"
+)
+
+// ClientStream 客户端的流，用于与服务端的流式方法收发数据。
+// 读到 io.EOF 或错误、ctx 结束后自动释放，提前放弃时需调用 Close 通知服务端取消
+type ClientStream struct {
+	ctx    context.Context
+	cli    *RPCClient
+	conn   *clientConn
+	stream *protocol.Stream
+
+	mutex sync.Mutex
+	err   error // 流结束的原因，读到 io.EOF 或错误后不再接收
+}
+
+// 从拦截器链的结果中取出流
+func streamResult(result []interface{}, err error) (*ClientStream, error) {
+	if err != nil {
+		return nil, err
+	}
+	if len(result) == 1 {
+		if cs, ok := result[0].(*ClientStream); ok && cs != nil {
+			return cs, nil
+		}
+	}
+	return nil, status.New(status.Internal, "拦截器未返回流！")
+}
+
+// StreamReader 按类型接收服务端流的结果
+type StreamReader[Y any] struct {
+	*ClientStream
+}
+
+// NewStreamReader 将流包装为按类型接收结果的读取器
+func NewStreamReader[Y any](stream *ClientStream) *StreamReader[Y] {
+	return &StreamReader[Y]{ClientStream: stream}
+}
+
+// Recv 接收下一条结果，服务端正常结束时返回 io.EOF
+func (r *StreamReader[Y]) Recv() (Y, error) {
+	return recvAs[Y](r.ClientStream)
+}
+
+// StreamWriter 按类型向客户端流方法发送数据，并接收方法的结果
+type StreamWriter[X, Y any] struct {
+	*ClientStream
+}
+
+// NewStreamWriter 将流包装为按类型发送数据的写入器
+func NewStreamWriter[X, Y any](stream *ClientStream) *StreamWriter[X, Y] {
+	return &StreamWriter[X, Y]{ClientStream: stream}
+}
+
+// Send 发送一条数据，服务端已结束调用时返回 io.EOF，需通过 CloseAndRecv 获取结果
+func (w *StreamWriter[X, Y]) Send(v X) error {
+	return w.SendMsg(v)
+}
+
+// CloseAndRecv 结束发送并等待服务端返回结果
+func (w *StreamWriter[X, Y]) CloseAndRecv() (Y, error) {
+	var value Y
+	if err := w.CloseSend(); err != nil {
+		return value, err
+	}
+	value, err := recvAs[Y](w.ClientStream)
+	if err == io.EOF {
+		return value, status.New(status.Internal, "服务端未返回结果！")
+	}
+	if err != nil {
+		return value, err
+	}
+	// 读取结束帧以释放流
+	if _, err = w.RecvMsg(); err != io.EOF {
+		return value, err
+	}
+	return value, nil
+}
+
+// StreamReadWriter 按类型与双向流方法收发数据，收发可在不同协程中进行
+type StreamReadWriter[X, Y any] struct {
+	*ClientStream
+}
+
+// NewStreamReadWriter 将流包装为按类型收发的双向流
+func NewStreamReadWriter[X, Y any](stream *ClientStream) *StreamReadWriter[X, Y] {
+	return &StreamReadWriter[X, Y]{ClientStream: stream}
+}
+
+// Send 发送一条数据，服务端已结束调用时返回 io.EOF，需通过 Recv 获取结束的原因
+func (rw *StreamReadWriter[X, Y]) Send(v X) error {
+	return rw.SendMsg(v)
+}
+
+// Recv 接收下一条结果，服务端正常结束时返回 io.EOF
+func (rw *StreamReadWriter[X, Y]) Recv() (Y, error) {
+	return recvAs[Y](rw.ClientStream)
+}
+
+func recvAs[Y any](cs *ClientStream) (Y, error) {
+	var value Y
+	item, err := cs.RecvMsg()
+	if err != nil || item == nil {
+		return value, err
+	}
+	value, ok := item.(Y)
+	if !ok {
+		return value, status.Errorf(status.Internal, "流结果类型不匹配：%T", item)
+	}
+	return value, nil
+}
+
+// SendMsg 发送一条数据，服务端接收慢时阻塞，直到服务端授予额度。
+// 服务端已结束调用时返回 io.EOF，结束的原因由 RecvMsg 返回
+func (cs *ClientStream) SendMsg(v interface{}) error {
+	if err := cs.finished(); err != nil {
+		return err
+	}
+	payload, err := global.Codecs[cs.cli.option.SerializeType].Encode([]interface{}{v})
+	if err != nil {
+		log.Printf("编码出现异常：%v\n", err)
+		return err
+	}
+	return cs.stream.Send(cs.ctx, payload)
+}
+
+// CloseSend 结束发送，服务端读完已发送的数据后收到 io.EOF，之后仍可继续接收
+func (cs *ClientStream) CloseSend() error {
+	if err := cs.finished(); err != nil {
+		return err
+	}
+	return cs.stream.CloseSend()
+}
+
+// RecvMsg 接收下一条结果，服务端正常结束时返回 io.EOF，以错误结束时返回对应的错误
+func (cs *ClientStream) RecvMsg() (interface{}, error) {
+	if err := cs.finished(); err != nil {
+		return nil, err
+	}
+
+	msg, err := cs.stream.Recv(cs.ctx)
+	if err == io.EOF {
+		return nil, cs.finish(err, true)
+	}
+	if err != nil {
+		return nil, cs.finish(err, false)
+	}
+	if msg.MsgType() == protocol.StreamError || msg.MsgType() == protocol.Error {
+		return nil, cs.finish(status.Unmarshal(msg.Payload), true)
+	}
+
+	item := make([]interface{}, 0, 1)
+	err = global.Codecs[msg.SerializeType()].Decode(msg.Payload, &item)
+	msg.Release()
+	if err != nil {
+		log.Printf("解码出现异常：%v\n", err)
+		return nil, cs.finish(err, false)
+	}
+	if len(item) == 0 {
+		return nil, nil
+	}
+	return item[0], nil
+}
+
+// Close 放弃接收，服务端尚未结束时通知其取消
+func (cs *ClientStream) Close() {
+	cs.finish(status.New(status.Canceled, "流已关闭！"), false)
+}
+
+// 流结束的原因，未结束时返回 nil
+func (cs *ClientStream) finished() error {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	return cs.err
+}
+
+// 结束流并释放，remoteEnded 为 false 时服务端尚未结束，发送取消帧
+func (cs *ClientStream) finish(err error, remoteEnded bool) error {
+	cs.mutex.Lock()
+	if cs.err != nil {
+		err = cs.err
+		cs.mutex.Unlock()
+		return err
+	}
+	cs.err = err
+	cs.mutex.Unlock()
+
+	if !remoteEnded {
+		cs.cli.cancelRequest(cs.conn, cs.stream.ID())
+	}
+	cs.stream.Close(err)
+	cs.conn.removeStream(cs.stream.ID())
+	return err
+}
+
+// ctx 结束时取消流，避免调用方不再接收时服务端一直阻塞
+func (cs *ClientStream) watch() {
+	select {
+	case <-cs.ctx.Done():
+		cs.finish(cs.ctx.Err(), false)
+	case <-cs.stream.Done():
+	}
+}
@@ -1,14 +1,17 @@
 package main
 
 import (
+	"context"
 	"encoding/gob"
 	"github.com/zhangweijie11/zRPC/global"
 	"github.com/zhangweijie11/zRPC/naming"
 	"github.com/zhangweijie11/zRPC/provider"
 	"gopkg.in/yaml.v3"
+	"log"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 )
 
 type Config struct {
@@ -58,8 +61,12 @@ func main() {
 
 	go rpcServer.Run()
 
-	quit := make(chan os.Signal)
+	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT)
 	<-quit
-	rpcServer.Shutdown()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := rpcServer.Shutdown(ctx); err != nil {
+		log.Println(err)
+	}
 }
@@ -0,0 +1,51 @@
+package metadata
+
+import "context"
+
+// MD 调用元数据，随请求传递给服务端，仅 v2 协议支持
+type MD map[string]string
+
+// Copy 复制元数据
+func (md MD) Copy() MD {
+	res := make(MD, len(md))
+	for k, v := range md {
+		res[k] = v
+	}
+	return res
+}
+
+type outgoingKey struct{}
+
+type incomingKey struct{}
+
+// NewOutgoingContext 为客户端调用设置元数据
+func NewOutgoingContext(ctx context.Context, md MD) context.Context {
+	return context.WithValue(ctx, outgoingKey{}, md)
+}
+
+// AppendToOutgoingContext 为客户端调用追加元数据，kv 依次为键和值
+func AppendToOutgoingContext(ctx context.Context, kv ...string) context.Context {
+	md, _ := FromOutgoingContext(ctx)
+	md = md.Copy()
+	for i := 0; i+1 < len(kv); i += 2 {
+		md[kv[i]] = kv[i+1]
+	}
+	return NewOutgoingContext(ctx, md)
+}
+
+// FromOutgoingContext 获取客户端调用的元数据
+func FromOutgoingContext(ctx context.Context) (MD, bool) {
+	md, ok := ctx.Value(outgoingKey{}).(MD)
+	return md, ok
+}
+
+// NewIncomingContext 为服务端处理的请求设置收到的元数据
+func NewIncomingContext(ctx context.Context, md MD) context.Context {
+	return context.WithValue(ctx, incomingKey{}, md)
+}
+
+// FromIncomingContext 获取服务端收到的元数据
+func FromIncomingContext(ctx context.Context) (MD, bool) {
+	md, ok := ctx.Value(incomingKey{}).(MD)
+	return md, ok
+}
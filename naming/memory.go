@@ -0,0 +1,85 @@
+package naming
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryRegistry 进程内的服务注册中心，注册与发现在同一进程内完成，用于本地开发及测试
+type MemoryRegistry struct {
+	mutex     sync.RWMutex
+	instances map[string][]*Instance // 按 AppID 索引的实例
+	watchers  *watchers
+}
+
+// NewMemoryRegistry 初始化进程内注册中心
+func NewMemoryRegistry() *MemoryRegistry {
+	return &MemoryRegistry{
+		instances: make(map[string][]*Instance),
+		watchers:  newWatchers(),
+	}
+}
+
+// Register 注册实例，返回的函数将其注销
+func (r *MemoryRegistry) Register(_ context.Context, instance *Instance) (context.CancelFunc, error) {
+	r.mutex.Lock()
+	r.instances[instance.AppID] = append(r.instances[instance.AppID], instance)
+	r.notify(instance.AppID)
+	r.mutex.Unlock()
+
+	var once sync.Once
+	return func() { once.Do(func() { r.unregister(instance) }) }, nil
+}
+
+func (r *MemoryRegistry) unregister(instance *Instance) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	instances := r.instances[instance.AppID]
+	for i, v := range instances {
+		if v == instance {
+			r.instances[instance.AppID] = append(instances[:i:i], instances[i+1:]...)
+			break
+		}
+	}
+	if len(r.instances[instance.AppID]) == 0 {
+		delete(r.instances, instance.AppID)
+	}
+	r.notify(instance.AppID)
+}
+
+// 推送应用的实例列表，需持有锁调用，保证推送顺序与变化顺序一致
+func (r *MemoryRegistry) notify(appID string) {
+	r.watchers.notify(appID, r.fetch(appID))
+}
+
+// Fetch 获取应用的所有实例
+func (r *MemoryRegistry) Fetch(_ context.Context, appID string) ([]*Instance, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	instances := r.fetch(appID)
+	return instances, len(instances) > 0
+}
+
+// 返回实例列表的副本，需持有锁调用
+func (r *MemoryRegistry) fetch(appID string) []*Instance {
+	instances, ok := r.instances[appID]
+	if !ok {
+		return nil
+	}
+	return append([]*Instance(nil), instances...)
+}
+
+// Watch 订阅应用的实例变化
+func (r *MemoryRegistry) Watch(ctx context.Context, appID string) <-chan []*Instance {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.watchers.add(ctx, appID, r.fetch(appID))
+}
+
+// Close 关闭所有订阅，已注册的实例保留
+func (r *MemoryRegistry) Close() error {
+	r.watchers.close()
+	return nil
+}
@@ -16,3 +16,9 @@ type Registry interface {
 	Fetch(context.Context, string) ([]*Instance, bool)
 	Close() error
 }
+
+// Watcher 注册中心可选实现的变化通知，订阅时先推送当前实例列表，之后每次变化推送最新列表，
+// 未及时读取时只保留最新列表。ctx 取消或注册中心关闭时关闭通道
+type Watcher interface {
+	Watch(ctx context.Context, appID string) <-chan []*Instance
+}
@@ -0,0 +1,249 @@
+package naming
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// StaticReloadInterval 未指定时检查配置文件变化的间隔
+const StaticReloadInterval = 5 * time.Second
+
+// StaticRegistry 由固定地址列表或配置文件构成的注册中心，不依赖注册中心集群。
+// 配置文件为 YAML 或 JSON，按 AppID 列出服务地址，如：
+//
+//	UserService:
+//	  - tcp://127.0.0.1:8080
+//	  - tls://10.0.0.2:8080
+//
+// 文件变化后自动重新加载，加载失败时保留之前的配置。
+// 进程内通过 Register 注册的实例与配置中的实例一并返回
+type StaticRegistry struct {
+	mutex    sync.RWMutex
+	static   map[string][]*Instance // 配置中的实例
+	local    map[string][]*Instance // 进程内注册的实例
+	watchers *watchers
+
+	path     string        // 配置文件路径，为空时不加载文件
+	interval time.Duration // 检查文件变化的间隔
+	modTime  time.Time     // 最近加载的文件修改时间
+	size     int64         // 最近加载的文件大小
+	done     chan struct{}
+	once     sync.Once
+}
+
+// NewStaticRegistry 由固定地址列表初始化注册中心，apps 为 AppID 到服务地址的映射
+func NewStaticRegistry(apps map[string][]string) *StaticRegistry {
+	r := newStaticRegistry()
+	r.static = staticInstances(apps)
+	return r
+}
+
+// NewStaticRegistryFromFile 由配置文件初始化注册中心，interval 为检查文件变化的间隔，0 表示使用 StaticReloadInterval
+func NewStaticRegistryFromFile(path string, interval time.Duration) (*StaticRegistry, error) {
+	if interval <= 0 {
+		interval = StaticReloadInterval
+	}
+	r := newStaticRegistry()
+	r.path = path
+	r.interval = interval
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+	go r.watchFile()
+	return r, nil
+}
+
+func newStaticRegistry() *StaticRegistry {
+	return &StaticRegistry{
+		static:   make(map[string][]*Instance),
+		local:    make(map[string][]*Instance),
+		watchers: newWatchers(),
+		done:     make(chan struct{}),
+	}
+}
+
+// 按地址列表生成实例，每个应用对应一个实例
+func staticInstances(apps map[string][]string) map[string][]*Instance {
+	instances := make(map[string][]*Instance, len(apps))
+	for appID, addrs := range apps {
+		if len(addrs) == 0 {
+			continue
+		}
+		instances[appID] = []*Instance{{
+			AppID:     appID,
+			Addresses: append([]string(nil), addrs...),
+			Status:    1,
+		}}
+	}
+	return instances
+}
+
+// 解析配置文件，扩展名为 .json 时按 JSON 解析，否则按 YAML 解析
+func parseStaticFile(path string, data []byte) (map[string][]string, error) {
+	apps := make(map[string][]string)
+	var err error
+	if filepath.Ext(path) == ".json" {
+		err = json.Unmarshal(data, &apps)
+	} else {
+		err = yaml.Unmarshal(data, &apps)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("解析注册中心配置 %s 失败：%w", path, err)
+	}
+	return apps, nil
+}
+
+// 文件变化时重新加载，返回是否加载了新配置
+func (r *StaticRegistry) reload() (bool, error) {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return false, err
+	}
+	if info.ModTime().Equal(r.modTime) && info.Size() == r.size {
+		return false, nil
+	}
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return false, err
+	}
+	// 解析失败时同样记录，文件再次变化前不重复加载
+	r.modTime, r.size = info.ModTime(), info.Size()
+	apps, err := parseStaticFile(r.path, data)
+	if err != nil {
+		return false, err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	old := r.static
+	r.static = staticInstances(apps)
+	// 只通知实例有变化的应用
+	for appID := range old {
+		if _, ok := r.static[appID]; !ok {
+			r.notify(appID)
+		}
+	}
+	for appID, instances := range r.static {
+		if !equalInstances(old[appID], instances) {
+			r.notify(appID)
+		}
+	}
+	return true, nil
+}
+
+func equalInstances(a, b []*Instance) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if len(a[i].Addresses) != len(b[i].Addresses) {
+			return false
+		}
+		for j := range a[i].Addresses {
+			if a[i].Addresses[j] != b[i].Addresses[j] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// 定期检查配置文件变化
+func (r *StaticRegistry) watchFile() {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if ok, err := r.reload(); err != nil {
+				log.Println("注册中心配置加载失败，保留之前的配置：", err)
+			} else if ok {
+				log.Println("注册中心配置已重新加载：", r.path)
+			}
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// Register 在进程内注册实例，返回的函数将其注销，不修改配置文件
+func (r *StaticRegistry) Register(_ context.Context, instance *Instance) (context.CancelFunc, error) {
+	select {
+	case <-r.done:
+		return nil, errors.New("注册中心已关闭")
+	default:
+	}
+	r.mutex.Lock()
+	r.local[instance.AppID] = append(r.local[instance.AppID], instance)
+	r.notify(instance.AppID)
+	r.mutex.Unlock()
+
+	var once sync.Once
+	return func() { once.Do(func() { r.unregister(instance) }) }, nil
+}
+
+func (r *StaticRegistry) unregister(instance *Instance) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	instances := r.local[instance.AppID]
+	for i, v := range instances {
+		if v == instance {
+			r.local[instance.AppID] = append(instances[:i:i], instances[i+1:]...)
+			break
+		}
+	}
+	if len(r.local[instance.AppID]) == 0 {
+		delete(r.local, instance.AppID)
+	}
+	r.notify(instance.AppID)
+}
+
+// 推送应用的实例列表，需持有锁调用
+func (r *StaticRegistry) notify(appID string) {
+	r.watchers.notify(appID, r.fetch(appID))
+}
+
+// Fetch 获取应用在配置中及进程内注册的所有实例
+func (r *StaticRegistry) Fetch(_ context.Context, appID string) ([]*Instance, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	instances := r.fetch(appID)
+	return instances, len(instances) > 0
+}
+
+// 返回实例列表的副本，需持有锁调用
+func (r *StaticRegistry) fetch(appID string) []*Instance {
+	static, local := r.static[appID], r.local[appID]
+	if len(static)+len(local) == 0 {
+		return nil
+	}
+	instances := make([]*Instance, 0, len(static)+len(local))
+	instances = append(instances, static...)
+	return append(instances, local...)
+}
+
+// Watch 订阅应用的实例变化，配置文件重新加载或进程内注册、注销时推送
+func (r *StaticRegistry) Watch(ctx context.Context, appID string) <-chan []*Instance {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.watchers.add(ctx, appID, r.fetch(appID))
+}
+
+// Close 停止检查配置文件并关闭所有订阅
+func (r *StaticRegistry) Close() error {
+	r.once.Do(func() {
+		close(r.done)
+		r.watchers.close()
+	})
+	return nil
+}
@@ -0,0 +1,91 @@
+package naming
+
+import (
+	"context"
+	"sync"
+)
+
+// 按 AppID 管理的变化订阅
+type watchers struct {
+	mutex  sync.Mutex
+	subs   map[string]map[chan []*Instance]struct{}
+	closed bool
+	done   chan struct{} // 关闭时关闭，结束等待订阅上下文的协程
+}
+
+func newWatchers() *watchers {
+	return &watchers{subs: make(map[string]map[chan []*Instance]struct{}), done: make(chan struct{})}
+}
+
+// 添加订阅，current 为订阅时的实例列表，为空时不推送
+func (w *watchers) add(ctx context.Context, appID string, current []*Instance) <-chan []*Instance {
+	ch := make(chan []*Instance, 1)
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		close(ch)
+		return ch
+	}
+	if w.subs[appID] == nil {
+		w.subs[appID] = make(map[chan []*Instance]struct{})
+	}
+	w.subs[appID][ch] = struct{}{}
+	if len(current) > 0 {
+		ch <- current
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			w.remove(appID, ch)
+		case <-w.done:
+		}
+	}()
+	return ch
+}
+
+func (w *watchers) remove(appID string, ch chan []*Instance) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if _, ok := w.subs[appID][ch]; !ok {
+		return
+	}
+	delete(w.subs[appID], ch)
+	if len(w.subs[appID]) == 0 {
+		delete(w.subs, appID)
+	}
+	close(ch)
+}
+
+// 推送最新实例列表，订阅方尚未读取的旧列表被替换
+func (w *watchers) notify(appID string, instances []*Instance) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	for ch := range w.subs[appID] {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- instances
+	}
+}
+
+// 关闭所有订阅，之后的订阅立即关闭
+func (w *watchers) close() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return
+	}
+	w.closed = true
+	close(w.done)
+	for appID, subs := range w.subs {
+		for ch := range subs {
+			close(ch)
+		}
+		delete(w.subs, appID)
+	}
+}
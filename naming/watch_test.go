@@ -0,0 +1,32 @@
+package naming
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// 以不会结束的上下文订阅，注册中心关闭后订阅通道关闭且等待协程退出
+func TestWatchEndsOnClose(t *testing.T) {
+	before := runtime.NumGoroutine()
+	r := NewMemoryRegistry()
+	chans := make([]<-chan []*Instance, 10)
+	for i := range chans {
+		chans[i] = r.Watch(context.Background(), "app")
+	}
+	r.Close()
+
+	for _, ch := range chans {
+		if _, ok := <-ch; ok {
+			t.Fatal("watch channel delivered after Close")
+		}
+	}
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d watch goroutines still running after Close", runtime.NumGoroutine()-before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,59 @@
+package protocol
+
+import "sync"
+
+const (
+	// 参数超过该长度时不再拷贝到帧缓冲区，与帧头一起通过 writev 写出
+	largePayloadLen = 32 << 10
+	// 容量超过该长度的缓冲区用完后不放回池中，避免长期占用内存
+	maxPooledBufferLen = 64 << 10
+	// 缓存的服务类名、方法名的最大数量
+	maxInternedNames = 4096
+)
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 0, 1024)
+		return &buf
+	},
+}
+
+// 从池中获取容量不小于 size 的缓冲区，长度为 0
+func getBuffer(size int) *[]byte {
+	buf := bufferPool.Get().(*[]byte)
+	if cap(*buf) < size {
+		*buf = make([]byte, 0, size)
+	}
+	*buf = (*buf)[:0]
+	return buf
+}
+
+func putBuffer(buf *[]byte) {
+	if cap(*buf) > maxPooledBufferLen {
+		return
+	}
+	bufferPool.Put(buf)
+}
+
+// 服务类名、方法名的种类有限，缓存解码出的字符串，避免每次解码都分配
+var names = struct {
+	sync.RWMutex
+	m map[string]string
+}{m: make(map[string]string)}
+
+func internName(b []byte) string {
+	names.RLock()
+	s, ok := names.m[string(b)]
+	names.RUnlock()
+	if ok {
+		return s
+	}
+
+	s = string(b)
+	names.Lock()
+	if len(names.m) < maxInternedNames {
+		names.m[s] = s
+	}
+	names.Unlock()
+	return s
+}
@@ -8,7 +8,8 @@ RPC 消息格式编码设计：
 消息类型（区分请求和响应），
 压缩类型，
 序列化协议类型，
-每个占 1 个字节（8 个 bit）。可扩展追加消息 ID 以及元数据等信息用于服务治理
+每个占 1 个字节（8 个 bit）。协议头之后的格式由协议版本决定，
+v1 为定长的长度字段，v2 追加了标志位、请求 ID 及元数据，长度字段改为变长编码
 */
 
 const (
@@ -21,6 +22,15 @@ const (
 	magicNumber byte = 0x06
 )
 
+const (
+	// 协议版本
+	Version1 byte = 1
+	Version2 byte = 2
+
+	// MaxVersion 当前支持的最高协议版本
+	MaxVersion = Version2
+)
+
 // 消息类型
 type MsgType byte
 
@@ -28,8 +38,32 @@ const (
 	// 消息类型
 	Request MsgType = iota
 	Response
+	Error     // 错误响应，消息体为错误码及错误信息
+	GoAway    // 服务端即将关闭，之后收到的请求不会被处理
+	Handshake // 协议版本协商，消息体为支持的版本列表或协商结果，始终使用 v1 格式
+	Cancel    // 取消请求 ID 对应的调用，仅 v2 支持
+
+	// 流式调用的帧，按请求 ID 归属到对应的流，仅 v2 支持
+	StreamData   // 流中的一条数据
+	StreamEnd    // 发送方结束发送
+	StreamError  // 流异常结束，消息体为错误码及错误信息
+	WindowUpdate // 接收方授予发送方的额度，消息体为增加的数据帧数（变长编码）
+)
+
+// Flags 消息标志位，仅 v2 支持
+type Flags byte
+
+const (
+	// OneWay 单向调用，服务端执行后不返回响应
+	OneWay Flags = 1 << iota
+	// Streaming 流式调用，请求之后的数据以流帧传输
+	Streaming
 )
 
+func (f Flags) Has(flag Flags) bool {
+	return f&flag != 0
+}
+
 type CompressType byte
 
 const (
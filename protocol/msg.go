@@ -4,135 +4,264 @@ import (
 	"encoding/binary"
 	"errors"
 	"io"
+	"net"
 )
 
 const (
 	// SplitLen 代表各部分长度，是 int32 类型（32bit），也就是 4 个字节，所以为 4
 	SplitLen = 4
+	// FrameHeaderLen 帧头长度：协议头加消息体总长度
+	FrameHeaderLen = HeaderLen + SplitLen
 )
 
+const (
+	// DefaultMaxBodyLen 默认的消息体最大长度
+	DefaultMaxBodyLen = 16 << 20
+	// DefaultMaxNameLen 默认的服务类名、方法名最大长度
+	DefaultMaxNameLen = 256
+)
+
+var (
+	ErrBadMagic           = errors.New("校验值错误！")
+	ErrTruncated          = errors.New("消息不完整！")
+	ErrMalformed          = errors.New("消息长度与内容不一致！")
+	ErrUnsupportedVersion = errors.New("不支持的协议版本！")
+	ErrFrameTooLarge      = errors.New("消息体超过最大长度！")
+	ErrNameTooLong        = errors.New("服务名或方法名超过最大长度！")
+)
+
+// Limits 解码时的长度限制，防止恶意或错误的长度导致超大内存分配
+type Limits struct {
+	MaxBodyLen uint32 // 消息体最大长度
+	MaxNameLen uint32 // 服务类名、方法名最大长度
+}
+
+// DefaultLimits 默认的长度限制
+var DefaultLimits = Limits{MaxBodyLen: DefaultMaxBodyLen, MaxNameLen: DefaultMaxNameLen}
+
 // 协议消息格式
 type RPCMsg struct {
-	*Header              // 协议头
-	ServiceClass  string // 调用的服务类名
-	ServiceMethod string // 调用的方法名
-	Payload       []byte // 调用的参数
+	*Header                         // 协议头
+	Flags         Flags             // 标志位，仅 v2
+	RequestID     uint64            // 请求 ID，响应携带相同的 ID，仅 v2
+	ServiceClass  string            // 调用的服务类名
+	ServiceMethod string            // 调用的方法名
+	Metadata      map[string]string // 元数据，仅 v2
+	Payload       []byte            // 调用的参数，解码得到的参数在 Release 之后不可再使用
+
+	buf *[]byte // 解码时从池中获取的缓冲区
+}
+
+// 消息与协议头一同分配，减少一次内存分配
+type msgWithHeader struct {
+	msg    RPCMsg
+	header Header
 }
 
 // NewRPCMsg 初始化消息格式
 func NewRPCMsg() *RPCMsg {
-	header := Header([HeaderLen]byte{})
-	header[0] = magicNumber
-	return &RPCMsg{Header: &header}
+	m := &msgWithHeader{}
+	m.header[0] = magicNumber
+	m.msg.Header = &m.header
+	return &m.msg
 }
 
-// Send 发送数据，数据格式为：协议头，总体长度，类名长度，类名，方法名长度，方法，参数长度，参数
+// Release 将解码使用的缓冲区放回池中，之后不能再访问 Payload。不调用时缓冲区由 GC 回收
+func (msg *RPCMsg) Release() {
+	if msg.buf == nil {
+		return
+	}
+	putBuffer(msg.buf)
+	msg.buf = nil
+	msg.Payload = nil
+}
+
+// Send 按协议头中的版本编码整帧后一次写出，参数较大时不拷贝参数，与帧头一起通过 writev 写出
 func (msg *RPCMsg) Send(writer io.Writer) error {
-	// 写入协议头
-	_, err := writer.Write(msg.Header[:])
+	large := len(msg.Payload) >= largePayloadLen
+	buf := getBuffer(0)
+	defer putBuffer(buf)
+
+	var err error
+	*buf, err = msg.appendFrame(*buf, !large)
 	if err != nil {
 		return err
 	}
+	if !large {
+		_, err = writer.Write(*buf)
+		return err
+	}
+	bufs := net.Buffers{*buf, msg.Payload}
+	_, err = bufs.WriteTo(writer)
+	return err
+}
+
+// 按协议头中的版本将整帧编码追加到 dst，withPayload 为 false 时不追加参数，由调用方紧接着写出
+func (msg *RPCMsg) appendFrame(dst []byte, withPayload bool) ([]byte, error) {
+	switch msg.Version() {
+	case Version1:
+		return msg.appendV1(dst, withPayload), nil
+	case Version2:
+		return msg.appendV2(dst, withPayload), nil
+	default:
+		return dst, ErrUnsupportedVersion
+	}
+}
+
+// v1 数据格式为：协议头，总体长度，类名长度，类名，方法名长度，方法，参数长度，参数
+func (msg *RPCMsg) appendV1(dst []byte, withPayload bool) []byte {
+	// 写入协议头
+	dst = append(dst, msg.Header[:]...)
 	// 消息体总长度，方便一次性解析
 	dataLen := SplitLen + len(msg.ServiceClass) + SplitLen + len(msg.ServiceMethod) + SplitLen + len(msg.Payload)
 	// 网络传输一般使用大端字节序，字节序即为字节的组成顺序，分为大端序（最高有效位放低地址）和小端序（最低有效位放低地址），
 	// CPU 一般采用小端序读写，TCP 网络传输一般采用大端序更为方便， binary.BigEndian 代码实现大端序
 	// 写入消息体长度
-	err = binary.Write(writer, binary.BigEndian, uint32(dataLen))
+	dst = binary.BigEndian.AppendUint32(dst, uint32(dataLen))
 
-	// 写入调用的服务类名长度
-	err = binary.Write(writer, binary.BigEndian, uint32(len(msg.ServiceClass)))
-	if err != nil {
-		return err
-	}
-	// 写入调用的服务类名
-	err = binary.Write(writer, binary.BigEndian, []byte(msg.ServiceClass))
-	if err != nil {
-		return err
-	}
+	// 写入调用的服务类名长度及服务类名
+	dst = binary.BigEndian.AppendUint32(dst, uint32(len(msg.ServiceClass)))
+	dst = append(dst, msg.ServiceClass...)
 
-	// 写入调用的服务方法名长度
-	err = binary.Write(writer, binary.BigEndian, uint32(len(msg.ServiceMethod)))
-	if err != nil {
-		return err
-	}
-	// 写入调用的服务方法名
-	err = binary.Write(writer, binary.BigEndian, []byte(msg.ServiceMethod))
-	if err != nil {
-		return err
-	}
+	// 写入调用的服务方法名长度及服务方法名
+	dst = binary.BigEndian.AppendUint32(dst, uint32(len(msg.ServiceMethod)))
+	dst = append(dst, msg.ServiceMethod...)
 
-	// 写入调用的服务参数长度
-	err = binary.Write(writer, binary.BigEndian, uint32(len(msg.Payload)))
-	if err != nil {
-		return err
-	}
-	// 写入调用的服务参数
-	err = binary.Write(writer, binary.BigEndian, msg.Payload)
-	if err != nil {
-		return err
+	// 写入调用的服务参数长度及参数
+	dst = binary.BigEndian.AppendUint32(dst, uint32(len(msg.Payload)))
+	if withPayload {
+		dst = append(dst, msg.Payload...)
 	}
-
-	return err
+	return dst
 }
 
-// Decode 解码
+// Decode 按默认长度限制解码
 func (msg *RPCMsg) Decode(r io.Reader) error {
+	return msg.DecodeWithLimits(r, DefaultLimits)
+}
+
+// DecodeWithLimits 解码，所有长度均先校验再使用，格式错误时返回对应的错误。
+// 在两帧之间读到连接关闭时返回 io.EOF
+func (msg *RPCMsg) DecodeWithLimits(r io.Reader, limits Limits) error {
 	// 读取协议头
 	_, err := io.ReadFull(r, msg.Header[:])
+	if err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return ErrTruncated
+		}
+		return err
+	}
 	if !msg.Header.CheckMagicNumber() {
-		return errors.New("校验值错误！")
+		return ErrBadMagic
 	}
 
-	// 消息体长度
-	headerByte := make([]byte, 4)
-	_, err = io.ReadFull(r, headerByte)
+	switch msg.Header.Version() {
+	case Version1:
+		return msg.decodeV1(r, limits)
+	case Version2:
+		return msg.decodeV2(r, limits)
+	default:
+		return ErrUnsupportedVersion
+	}
+}
+
+// 解码 v1 协议头之后的部分
+func (msg *RPCMsg) decodeV1(r io.Reader, limits Limits) error {
+	// 长度字段与消息体使用同一个池中的缓冲区
+	msg.buf = getBuffer(SplitLen)
+	lenBuf := (*msg.buf)[:SplitLen]
+	_, err := io.ReadFull(r, lenBuf)
 	if err != nil {
-		return err
+		return truncated(err)
 	}
 
 	// 获取消息体长度
-	bodyLen := binary.BigEndian.Uint32(headerByte)
+	bodyLen := binary.BigEndian.Uint32(lenBuf)
+	if bodyLen > limits.MaxBodyLen {
+		return ErrFrameTooLarge
+	}
 	// 一次性获取整个消息体，再依次拆解
-	data := make([]byte, bodyLen)
+	data := msg.readBuffer(int(bodyLen))
 	_, err = io.ReadFull(r, data)
+	if err != nil {
+		return truncated(err)
+	}
 
-	// 调用的服务类名长度
-	start := 0
-	end := start + SplitLen
-	classLen := binary.BigEndian.Uint32(data[start:end])
-
-	// 调用的服务类名
-	start = end
-	end = start + int(classLen)
-	msg.ServiceClass = string(data[start:end])
+	return msg.decodeBody(data, limits)
+}
 
-	// 调用的方法名长度
-	start = end
-	end = start + SplitLen
-	methodLen := binary.BigEndian.Uint32(data[start:end])
+// 获取长度为 n 的读缓冲区，容量不足时替换为新的缓冲区
+func (msg *RPCMsg) readBuffer(n int) []byte {
+	if cap(*msg.buf) < n {
+		putBuffer(msg.buf)
+		msg.buf = getBuffer(n)
+	}
+	*msg.buf = (*msg.buf)[:n]
+	return *msg.buf
+}
 
-	// 调用的方法
-	start = end
-	end = start + int(methodLen)
-	msg.ServiceMethod = string(data[start:end])
+// 拆解消息体：类名长度，类名，方法名长度，方法，参数长度，参数
+func (msg *RPCMsg) decodeBody(data []byte, limits Limits) error {
+	// 调用的服务类名
+	class, data, err := readField(data, limits.MaxNameLen, ErrNameTooLong)
+	if err != nil {
+		return err
+	}
+	// 调用的方法名
+	method, data, err := readField(data, limits.MaxNameLen, ErrNameTooLong)
+	if err != nil {
+		return err
+	}
+	// 调用的参数
+	payload, data, err := readField(data, limits.MaxBodyLen, ErrFrameTooLarge)
+	if err != nil {
+		return err
+	}
+	if len(data) != 0 {
+		return ErrMalformed
+	}
 
-	// 调用的参数长度
-	start = end
-	end = start + SplitLen
-	binary.BigEndian.Uint32(data[start:end])
+	msg.ServiceClass = internName(class)
+	msg.ServiceMethod = internName(method)
+	msg.Payload = payload
+	return nil
+}
 
-	// 调用的参数
-	start = end
-	msg.Payload = data[start:]
+// 读取一个“长度 + 内容”的字段，返回内容及剩余数据
+func readField(data []byte, maxLen uint32, tooLong error) ([]byte, []byte, error) {
+	if len(data) < SplitLen {
+		return nil, nil, ErrTruncated
+	}
+	fieldLen := binary.BigEndian.Uint32(data)
+	if fieldLen > maxLen {
+		return nil, nil, tooLong
+	}
+	data = data[SplitLen:]
+	if uint64(fieldLen) > uint64(len(data)) {
+		return nil, nil, ErrTruncated
+	}
+	return data[:fieldLen], data[fieldLen:], nil
+}
 
+// 帧头之后读到连接关闭，说明消息不完整
+func truncated(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrTruncated
+	}
 	return err
 }
 
+// Read 按默认长度限制读取一条消息
 func Read(r io.Reader) (*RPCMsg, error) {
+	return ReadWithLimits(r, DefaultLimits)
+}
+
+// ReadWithLimits 按指定长度限制读取一条消息
+func ReadWithLimits(r io.Reader, limits Limits) (*RPCMsg, error) {
 	msg := NewRPCMsg()
-	err := msg.Decode(r)
+	err := msg.DecodeWithLimits(r, limits)
 	if err != nil {
+		msg.Release()
 		return nil, err
 	}
 
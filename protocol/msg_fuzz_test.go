@@ -0,0 +1,80 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// 编码一帧作为种子
+func encodeFrame(t testing.TB, version byte, flags Flags, class, method string, metadata map[string]string, payload []byte) []byte {
+	msg := NewRPCMsg()
+	msg.SetVersion(version)
+	msg.SetMsgType(Request)
+	msg.SetSerializeType(Gob)
+	msg.Flags = flags
+	msg.RequestID = 42
+	msg.ServiceClass = class
+	msg.ServiceMethod = method
+	msg.Metadata = metadata
+	msg.Payload = payload
+
+	var buf bytes.Buffer
+	if err := msg.Send(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// FuzzRead 任意输入都不能使解码 panic，解码成功的消息重新编码后应得到相同内容
+func FuzzRead(f *testing.F) {
+	v1 := encodeFrame(f, Version1, 0, "User", "GetUserByID", nil, []byte("payload"))
+	v2 := encodeFrame(f, Version2, OneWay, "User", "GetUserByID", map[string]string{"trace": "abc"}, []byte("payload"))
+	f.Add(v1)
+	f.Add(v2)
+	f.Add(encodeFrame(f, Version1, 0, "", "", nil, nil))
+	f.Add(encodeFrame(f, Version2, Streaming, "", "", nil, nil))
+	// 不完整的帧
+	f.Add(v1[:HeaderLen])
+	f.Add(v1[:FrameHeaderLen+2])
+	f.Add(v1[:len(v1)-1])
+	f.Add(v2[:HeaderLen+1])
+	f.Add(v2[:len(v2)-1])
+	// 超大的长度前缀
+	oversizedV1 := append([]byte(nil), v1...)
+	binary.BigEndian.PutUint32(oversizedV1[HeaderLen:], 0xFFFFFFFF)
+	f.Add(oversizedV1)
+	oversizedName := append([]byte(nil), v1...)
+	binary.BigEndian.PutUint32(oversizedName[FrameHeaderLen:], 0xFFFFFFF0)
+	f.Add(oversizedName)
+	f.Add(append(append([]byte(nil), v2[:HeaderLen+2]...), 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x01))
+	// 校验值及版本错误
+	f.Add([]byte{0x00, Version1, 0, 0, 0})
+	f.Add([]byte{magicNumber, 0xFF, 0, 0, 0})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		msg, err := Read(bytes.NewReader(data))
+		if err != nil {
+			if msg != nil {
+				t.Fatalf("Read returned a message with error %v", err)
+			}
+			return
+		}
+		defer msg.Release()
+
+		var buf bytes.Buffer
+		if err := msg.Send(&buf); err != nil {
+			t.Fatalf("re-encode decoded message: %v", err)
+		}
+		again, err := Read(&buf)
+		if err != nil {
+			t.Fatalf("decode re-encoded message: %v", err)
+		}
+		defer again.Release()
+		if *again.Header != *msg.Header || again.Flags != msg.Flags || again.RequestID != msg.RequestID ||
+			again.ServiceClass != msg.ServiceClass || again.ServiceMethod != msg.ServiceMethod ||
+			!bytes.Equal(again.Payload, msg.Payload) || len(again.Metadata) != len(msg.Metadata) {
+			t.Fatalf("round trip mismatch: %+v != %+v", again, msg)
+		}
+	})
+}
@@ -0,0 +1,75 @@
+package protocol
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func newBenchMsg(version byte, msgType MsgType, payload []byte) *RPCMsg {
+	msg := NewRPCMsg()
+	msg.SetVersion(version)
+	msg.SetMsgType(msgType)
+	msg.RequestID = 1
+	msg.ServiceClass = "Hello"
+	msg.ServiceMethod = "Hello"
+	msg.Payload = payload
+	return msg
+}
+
+func encodeMsg(b *testing.B, msg *RPCMsg) []byte {
+	var buf bytes.Buffer
+	if err := msg.Send(&buf); err != nil {
+		b.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// 客户端协议路径：编码发送请求，读取并解码响应
+func benchmarkClientPath(b *testing.B, version byte) {
+	payload := make([]byte, 128)
+	req := newBenchMsg(version, Request, payload)
+	resp := encodeMsg(b, newBenchMsg(version, Response, payload))
+	reader := bytes.NewReader(resp)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := req.Send(io.Discard); err != nil {
+			b.Fatal(err)
+		}
+		reader.Reset(resp)
+		msg, err := Read(reader)
+		if err != nil {
+			b.Fatal(err)
+		}
+		msg.Release()
+	}
+}
+
+// 服务端协议路径：读取并解码请求，编码发送响应
+func benchmarkServerPath(b *testing.B, version byte) {
+	payload := make([]byte, 128)
+	req := encodeMsg(b, newBenchMsg(version, Request, payload))
+	reader := bytes.NewReader(req)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		reader.Reset(req)
+		msg, err := Read(reader)
+		if err != nil {
+			b.Fatal(err)
+		}
+		resp := newBenchMsg(msg.Version(), Response, msg.Payload)
+		if err = resp.Send(io.Discard); err != nil {
+			b.Fatal(err)
+		}
+		msg.Release()
+	}
+}
+
+func BenchmarkClientPathV1(b *testing.B) { benchmarkClientPath(b, Version1) }
+func BenchmarkClientPathV2(b *testing.B) { benchmarkClientPath(b, Version2) }
+func BenchmarkServerPathV1(b *testing.B) { benchmarkServerPath(b, Version1) }
+func BenchmarkServerPathV2(b *testing.B) { benchmarkServerPath(b, Version2) }
@@ -0,0 +1,185 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+/*
+v2 协议头之后的格式：
+标志位（1 字节），
+请求 ID（变长），
+消息体长度（变长），
+消息体：类名长度（变长），类名，方法名长度（变长），方法名，
+元数据个数（变长），依次为键长度（变长），键，值长度（变长），值，
+剩余部分为参数
+*/
+
+// v2 数据格式编码
+func (msg *RPCMsg) appendV2(dst []byte, withPayload bool) []byte {
+	bodyLen := stringLen(msg.ServiceClass) + stringLen(msg.ServiceMethod) + uvarintLen(uint64(len(msg.Metadata)))
+	for key, value := range msg.Metadata {
+		bodyLen += stringLen(key) + stringLen(value)
+	}
+	bodyLen += len(msg.Payload)
+
+	dst = append(dst, msg.Header[:]...)
+	dst = append(dst, byte(msg.Flags))
+	dst = binary.AppendUvarint(dst, msg.RequestID)
+	dst = binary.AppendUvarint(dst, uint64(bodyLen))
+	dst = appendString(dst, msg.ServiceClass)
+	dst = appendString(dst, msg.ServiceMethod)
+	dst = binary.AppendUvarint(dst, uint64(len(msg.Metadata)))
+	for key, value := range msg.Metadata {
+		dst = appendString(dst, key)
+		dst = appendString(dst, value)
+	}
+	if withPayload {
+		dst = append(dst, msg.Payload...)
+	}
+	return dst
+}
+
+func appendString(data []byte, s string) []byte {
+	data = binary.AppendUvarint(data, uint64(len(s)))
+	return append(data, s...)
+}
+
+// 编码“变长长度 + 内容”字段所占的字节数
+func stringLen(s string) int {
+	return uvarintLen(uint64(len(s))) + len(s)
+}
+
+// 变长整数编码后所占的字节数
+func uvarintLen(x uint64) int {
+	n := 1
+	for x >= 0x80 {
+		x >>= 7
+		n++
+	}
+	return n
+}
+
+// 解码 v2 协议头之后的部分
+func (msg *RPCMsg) decodeV2(r io.Reader, limits Limits) error {
+	// 逐字节读取标志位和变长整数时使用池中的缓冲区，之后用于读取消息体
+	msg.buf = getBuffer(1)
+	scratch := (*msg.buf)[:1]
+
+	_, err := io.ReadFull(r, scratch)
+	if err != nil {
+		return truncated(err)
+	}
+	msg.Flags = Flags(scratch[0])
+
+	msg.RequestID, err = readUvarint(r, scratch)
+	if err != nil {
+		return err
+	}
+
+	bodyLen, err := readUvarint(r, scratch)
+	if err != nil {
+		return err
+	}
+	if bodyLen > uint64(limits.MaxBodyLen) {
+		return ErrFrameTooLarge
+	}
+	data := msg.readBuffer(int(bodyLen))
+	_, err = io.ReadFull(r, data)
+	if err != nil {
+		return truncated(err)
+	}
+
+	return msg.decodeBodyV2(data, limits)
+}
+
+func (msg *RPCMsg) decodeBodyV2(data []byte, limits Limits) error {
+	class, data, err := readVarField(data, limits.MaxNameLen, ErrNameTooLong)
+	if err != nil {
+		return err
+	}
+	method, data, err := readVarField(data, limits.MaxNameLen, ErrNameTooLong)
+	if err != nil {
+		return err
+	}
+
+	count, data, err := uvarint(data)
+	if err != nil {
+		return err
+	}
+	// 每个键值对至少占 2 字节，先按剩余长度校验个数，避免按恶意的个数分配内存
+	if count > uint64(len(data))/2 {
+		return ErrTruncated
+	}
+	var metadata map[string]string
+	if count > 0 {
+		metadata = make(map[string]string, count)
+	}
+	for i := uint64(0); i < count; i++ {
+		var key, value []byte
+		key, data, err = readVarField(data, limits.MaxBodyLen, ErrFrameTooLarge)
+		if err != nil {
+			return err
+		}
+		value, data, err = readVarField(data, limits.MaxBodyLen, ErrFrameTooLarge)
+		if err != nil {
+			return err
+		}
+		metadata[string(key)] = string(value)
+	}
+
+	msg.ServiceClass = internName(class)
+	msg.ServiceMethod = internName(method)
+	msg.Metadata = metadata
+	msg.Payload = data
+	return nil
+}
+
+// 读取一个“变长长度 + 内容”的字段，返回内容及剩余数据
+func readVarField(data []byte, maxLen uint32, tooLong error) ([]byte, []byte, error) {
+	fieldLen, data, err := uvarint(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if fieldLen > uint64(maxLen) {
+		return nil, nil, tooLong
+	}
+	if fieldLen > uint64(len(data)) {
+		return nil, nil, ErrTruncated
+	}
+	return data[:fieldLen], data[fieldLen:], nil
+}
+
+// 从数据中解码变长整数，返回剩余数据
+func uvarint(data []byte) (uint64, []byte, error) {
+	x, n := binary.Uvarint(data)
+	if n == 0 {
+		return 0, nil, ErrTruncated
+	}
+	if n < 0 {
+		return 0, nil, ErrMalformed
+	}
+	return x, data[n:], nil
+}
+
+// 从连接逐字节读取变长整数，scratch 为长度 1 的缓冲区，溢出时返回 ErrMalformed
+func readUvarint(r io.Reader, scratch []byte) (uint64, error) {
+	var x uint64
+	var shift uint
+	for i := 0; i < binary.MaxVarintLen64; i++ {
+		_, err := io.ReadFull(r, scratch)
+		if err != nil {
+			return 0, truncated(err)
+		}
+		b := scratch[0]
+		if b < 0x80 {
+			if i == binary.MaxVarintLen64-1 && b > 1 {
+				return 0, ErrMalformed
+			}
+			return x | uint64(b)<<shift, nil
+		}
+		x |= uint64(b&0x7f) << shift
+		shift += 7
+	}
+	return 0, ErrMalformed
+}
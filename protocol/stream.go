@@ -0,0 +1,264 @@
+package protocol
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+)
+
+const (
+	// DefaultStreamWindow 默认的流控窗口，即接收方最多缓冲的数据帧数
+	DefaultStreamWindow = 16
+	// MaxStreamWindow 流控窗口的上限，对端授予的额度累计不能超过该值
+	MaxStreamWindow = 1 << 16
+)
+
+var (
+	ErrStreamClosed   = errors.New("流已关闭！")
+	ErrWindowExceeded = errors.New("对端发送的数据帧超过流控窗口！")
+	ErrWindowOverflow = errors.New("对端授予的额度超过流控窗口上限！")
+)
+
+// Stream 流式调用一端的传输状态，连接的读协程通过 Deliver 投递对端发来的帧。
+// 发送方只能在对端授予的额度内发送数据帧，接收方每消费半个窗口再向对端授予额度，
+// 接收慢的一端会使对端的发送阻塞，双方都不会无限缓冲
+type Stream struct {
+	id            uint64
+	version       byte
+	serializeType SerializeType
+	window        int
+	write         func(*RPCMsg) error
+	client        bool // 客户端一端，服务端结束即调用结束
+
+	mutex      sync.Mutex
+	credit     int  // 可发送的数据帧数
+	consumed   int  // 已消费但尚未授予对端的数据帧数
+	sendClosed bool // 已结束发送
+	creditCh   chan struct{}
+
+	frames      chan *RPCMsg  // 收到的数据帧及结束帧
+	remoteEnded chan struct{} // 对端结束发送时关闭，仅由读协程关闭
+	ended       bool
+	done        chan struct{}
+	once        sync.Once
+	err         error // 流关闭的原因，done 关闭后可读
+}
+
+// NewStream 初始化流，write 用于在连接上写出帧，window 为本端的接收窗口，不超过 MaxStreamWindow
+func NewStream(id uint64, version byte, serializeType SerializeType, window int, write func(*RPCMsg) error) *Stream {
+	if window <= 0 {
+		window = DefaultStreamWindow
+	}
+	if window > MaxStreamWindow {
+		window = MaxStreamWindow
+	}
+	return &Stream{
+		id:            id,
+		version:       version,
+		serializeType: serializeType,
+		window:        window,
+		write:         write,
+		creditCh:      make(chan struct{}, 1),
+		// 对端结束发送的帧可能紧跟在占满窗口的数据帧之后
+		frames:      make(chan *RPCMsg, window+1),
+		remoteEnded: make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// NewClientStream 初始化客户端一端的流。服务端结束流即调用结束，之后的发送返回 io.EOF，
+// 调用方通过 Recv 获取调用结果
+func NewClientStream(id uint64, version byte, serializeType SerializeType, window int, write func(*RPCMsg) error) *Stream {
+	s := NewStream(id, version, serializeType, window, write)
+	s.client = true
+	return s
+}
+
+// ID 流对应的请求 ID
+func (s *Stream) ID() uint64 {
+	return s.id
+}
+
+// Done 流关闭时关闭
+func (s *Stream) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *Stream) newFrame(msgType MsgType) *RPCMsg {
+	msg := NewRPCMsg()
+	msg.SetVersion(s.version)
+	msg.SetMsgType(msgType)
+	msg.SetSerializeType(s.serializeType)
+	msg.RequestID = s.id
+	return msg
+}
+
+// Open 向对端授予整个接收窗口的额度，流建立后调用一次
+func (s *Stream) Open() error {
+	return s.grant(s.window)
+}
+
+func (s *Stream) grant(n int) error {
+	msg := s.newFrame(WindowUpdate)
+	msg.Payload = binary.AppendUvarint(nil, uint64(n))
+	return s.write(msg)
+}
+
+// Send 发送一条数据，没有额度时阻塞，直到对端授予额度、流关闭或 ctx 结束
+func (s *Stream) Send(ctx context.Context, payload []byte) error {
+	// 服务端一端只是客户端结束发送，不影响服务端继续发送
+	var remoteEnded <-chan struct{}
+	if s.client {
+		remoteEnded = s.remoteEnded
+	}
+	for {
+		select {
+		case <-remoteEnded:
+			return io.EOF
+		default:
+		}
+		s.mutex.Lock()
+		if s.sendClosed {
+			s.mutex.Unlock()
+			return ErrStreamClosed
+		}
+		if s.credit > 0 {
+			s.credit--
+			s.mutex.Unlock()
+			msg := s.newFrame(StreamData)
+			msg.Payload = payload
+			return s.write(msg)
+		}
+		s.mutex.Unlock()
+
+		select {
+		case <-s.creditCh:
+		case <-remoteEnded:
+			return io.EOF
+		case <-s.done:
+			return s.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// CloseSend 结束发送，对端读完已发送的数据后收到 io.EOF
+func (s *Stream) CloseSend() error {
+	if !s.closeSend() {
+		return nil
+	}
+	return s.write(s.newFrame(StreamEnd))
+}
+
+// SendError 以错误结束发送，payload 为错误码及错误信息
+func (s *Stream) SendError(payload []byte) error {
+	if !s.closeSend() {
+		return nil
+	}
+	msg := s.newFrame(StreamError)
+	msg.Payload = payload
+	return s.write(msg)
+}
+
+// 标记结束发送，已结束时返回 false
+func (s *Stream) closeSend() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.sendClosed {
+		return false
+	}
+	s.sendClosed = true
+	return true
+}
+
+// Recv 接收下一条数据帧。对端结束发送时返回 io.EOF；
+// 对端以错误结束时返回该帧，由调用方解析错误；流关闭或 ctx 结束时返回对应的错误
+func (s *Stream) Recv(ctx context.Context) (*RPCMsg, error) {
+	var msg *RPCMsg
+	select {
+	case msg = <-s.frames:
+	default:
+		select {
+		case msg = <-s.frames:
+		case <-s.done:
+			// 流关闭前收到的帧仍可读取
+			select {
+			case msg = <-s.frames:
+			default:
+				return nil, s.err
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	switch msg.MsgType() {
+	case StreamEnd:
+		return nil, io.EOF
+	case StreamData:
+		return msg, s.consume()
+	default:
+		return msg, nil
+	}
+}
+
+// 消费一条数据帧，累计消费半个窗口后向对端授予额度
+func (s *Stream) consume() error {
+	s.mutex.Lock()
+	s.consumed++
+	n := s.consumed
+	if n < (s.window+1)/2 {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.consumed = 0
+	s.mutex.Unlock()
+	return s.grant(n)
+}
+
+// Deliver 投递对端发来的帧，由连接的读协程调用。对端发送的数据帧超过窗口时返回 ErrWindowExceeded，
+// 授予的额度累计超过 MaxStreamWindow 时返回 ErrWindowOverflow
+func (s *Stream) Deliver(msg *RPCMsg) error {
+	if msg.MsgType() == WindowUpdate {
+		n, _, err := uvarint(msg.Payload)
+		if err != nil {
+			return err
+		}
+		s.mutex.Lock()
+		// 正常的对端授予的额度不会超过其窗口，先比较再累加，避免恶意的额度使 credit 溢出为负数
+		if n > uint64(MaxStreamWindow-s.credit) {
+			s.mutex.Unlock()
+			return ErrWindowOverflow
+		}
+		s.credit += int(n)
+		s.mutex.Unlock()
+		select {
+		case s.creditCh <- struct{}{}:
+		default:
+		}
+		return nil
+	}
+
+	if msg.MsgType() != StreamData && !s.ended {
+		s.ended = true
+		close(s.remoteEnded)
+	}
+	select {
+	case s.frames <- msg:
+		return nil
+	default:
+		return ErrWindowExceeded
+	}
+}
+
+// Close 关闭流，阻塞中的发送和接收返回 err，重复关闭无效
+func (s *Stream) Close(err error) {
+	s.once.Do(func() {
+		s.err = err
+		close(s.done)
+	})
+}
@@ -0,0 +1,32 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+func windowUpdate(n uint64) *RPCMsg {
+	msg := NewRPCMsg()
+	msg.SetVersion(Version2)
+	msg.SetMsgType(WindowUpdate)
+	msg.Payload = binary.AppendUvarint(nil, n)
+	return msg
+}
+
+// 超过上限的额度被拒绝，credit 不会溢出
+func TestDeliverWindowOverflow(t *testing.T) {
+	s := NewStream(1, Version2, Gob, 0, func(*RPCMsg) error { return nil })
+	if err := s.Deliver(windowUpdate(math.MaxUint64)); err != ErrWindowOverflow {
+		t.Fatalf("huge increment: got %v, want ErrWindowOverflow", err)
+	}
+	if err := s.Deliver(windowUpdate(MaxStreamWindow)); err != nil {
+		t.Fatalf("increment up to the maximum window: %v", err)
+	}
+	if err := s.Deliver(windowUpdate(1)); err != ErrWindowOverflow {
+		t.Fatalf("increment beyond the maximum window: got %v, want ErrWindowOverflow", err)
+	}
+	if s.credit != MaxStreamWindow {
+		t.Fatalf("credit = %d, want %d", s.credit, MaxStreamWindow)
+	}
+}
@@ -0,0 +1,36 @@
+package protocol
+
+// SupportedVersions 不超过 max 的所有协议版本，从低到高
+func SupportedVersions(max byte) []byte {
+	if max > MaxVersion {
+		max = MaxVersion
+	}
+	versions := make([]byte, 0, max)
+	for v := Version1; v <= max; v++ {
+		versions = append(versions, v)
+	}
+	return versions
+}
+
+// Negotiate 从对端支持的版本中选出双方都支持的最高版本，没有共同版本时退回 v1
+func Negotiate(peer []byte, max byte) byte {
+	if max > MaxVersion {
+		max = MaxVersion
+	}
+	version := Version1
+	for _, v := range peer {
+		if v <= max && v > version {
+			version = v
+		}
+	}
+	return version
+}
+
+// NewHandshake 初始化版本协商消息，为兼容只支持 v1 的对端，始终使用 v1 格式
+func NewHandshake(versions []byte) *RPCMsg {
+	msg := NewRPCMsg()
+	msg.SetVersion(Version1)
+	msg.SetMsgType(Handshake)
+	msg.Payload = versions
+	return msg
+}
@@ -0,0 +1,187 @@
+package protocol
+
+import (
+	"net"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// BatchOption 合并写配置
+type BatchOption struct {
+	BufferSize   int           // 待写出的数据超过该长度时不再等待 MaxDelay 立即写出，0 表示使用默认值
+	MaxDelay     time.Duration // 收到第一帧后继续等待更多帧的最长时间，0 表示写协程空闲时立即写出
+	WriteTimeout time.Duration // 每次写出的超时时间，0 表示不限制
+}
+
+// 合并写的默认缓冲区大小
+const defaultBatchBufferSize = 32 << 10
+
+// BatchWriter 合并写：并发写入的帧依次编码到同一个缓冲区，由连接的写协程在空闲时一次写出。
+// 写协程写出期间到达的帧进入另一个缓冲区，等待下一次写出，连接上多路复用的调用越多，每次写出合并的帧越多
+type BatchWriter struct {
+	conn   net.Conn
+	option BatchOption
+
+	mutex   sync.Mutex
+	pending []byte      // 等待写出的帧
+	batch   *writeBatch // pending 中的帧所属的批次
+	err     error       // 写出失败或关闭的原因，之后的写入直接返回
+
+	wakeup  chan struct{} // 有新的帧等待写出
+	closing chan struct{}
+	once    sync.Once
+}
+
+// 一次写出的批次，写出后关闭 done，err 为写出结果
+type writeBatch struct {
+	done chan struct{}
+	err  error
+}
+
+func newWriteBatch() *writeBatch {
+	return &writeBatch{done: make(chan struct{})}
+}
+
+// NewBatchWriter 初始化合并写，并启动写协程
+func NewBatchWriter(conn net.Conn, option BatchOption) *BatchWriter {
+	if option.BufferSize <= 0 {
+		option.BufferSize = defaultBatchBufferSize
+	}
+	bw := &BatchWriter{
+		conn:    conn,
+		option:  option,
+		pending: make([]byte, 0, option.BufferSize),
+		batch:   newWriteBatch(),
+		wakeup:  make(chan struct{}, 1),
+		closing: make(chan struct{}),
+	}
+	go bw.loop()
+	return bw
+}
+
+// Write 将消息编码到待写出的缓冲区，等待所在批次写出后返回
+func (bw *BatchWriter) Write(msg *RPCMsg) error {
+	bw.mutex.Lock()
+	if bw.err != nil {
+		err := bw.err
+		bw.mutex.Unlock()
+		return err
+	}
+	pending, err := msg.appendFrame(bw.pending, true)
+	if err != nil {
+		bw.mutex.Unlock()
+		return err
+	}
+	bw.pending = pending
+	batch := bw.batch
+	bw.mutex.Unlock()
+
+	select {
+	case bw.wakeup <- struct{}{}:
+	default:
+		// 写协程已被唤醒
+	}
+	<-batch.done
+	return batch.err
+}
+
+// Close 停止写协程，之后的写入返回 net.ErrClosed
+func (bw *BatchWriter) Close() {
+	bw.once.Do(func() {
+		close(bw.closing)
+	})
+}
+
+func (bw *BatchWriter) loop() {
+	// 与 pending 交替使用，写出期间新到达的帧写入另一个缓冲区
+	writing := make([]byte, 0, bw.option.BufferSize)
+	var timer *time.Timer
+	if bw.option.MaxDelay > 0 {
+		timer = time.NewTimer(bw.option.MaxDelay)
+		bw.stopTimer(timer)
+	}
+
+	for {
+		select {
+		case <-bw.wakeup:
+		case <-bw.closing:
+			bw.fail(net.ErrClosed)
+			return
+		}
+		if timer != nil {
+			bw.delay(timer)
+		} else {
+			// 唤醒写协程的调用方随即阻塞等待，写协程会被优先调度，
+			// 先让出处理器，使其他就绪的调用方写入各自的帧后再一起写出
+			runtime.Gosched()
+		}
+
+		bw.mutex.Lock()
+		writing, bw.pending = bw.pending, writing[:0]
+		batch := bw.batch
+		bw.batch = newWriteBatch()
+		bw.mutex.Unlock()
+		if len(writing) == 0 {
+			// 帧已在上一次唤醒时写出
+			close(batch.done)
+			continue
+		}
+
+		if bw.option.WriteTimeout > 0 {
+			bw.conn.SetWriteDeadline(time.Now().Add(bw.option.WriteTimeout))
+		}
+		_, batch.err = bw.conn.Write(writing)
+		close(batch.done)
+		if batch.err != nil {
+			bw.fail(batch.err)
+			return
+		}
+		// 写出过大的帧后不保留大缓冲区
+		if cap(writing) > maxPooledBufferLen && cap(writing) > bw.option.BufferSize {
+			writing = make([]byte, 0, bw.option.BufferSize)
+		}
+	}
+}
+
+// 等待更多的帧，直到超过最大等待时间或待写出的数据超过缓冲区大小
+func (bw *BatchWriter) delay(timer *time.Timer) {
+	timer.Reset(bw.option.MaxDelay)
+	defer bw.stopTimer(timer)
+	for {
+		bw.mutex.Lock()
+		full := len(bw.pending) >= bw.option.BufferSize
+		bw.mutex.Unlock()
+		if full {
+			return
+		}
+
+		select {
+		case <-bw.wakeup:
+		case <-timer.C:
+			return
+		case <-bw.closing:
+			return
+		}
+	}
+}
+
+func (bw *BatchWriter) stopTimer(timer *time.Timer) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+}
+
+// 写协程退出，等待中及之后的写入均返回 err
+func (bw *BatchWriter) fail(err error) {
+	bw.mutex.Lock()
+	defer bw.mutex.Unlock()
+
+	bw.err = err
+	bw.batch.err = err
+	close(bw.batch.done)
+	bw.pending = nil
+}
@@ -0,0 +1,58 @@
+package protocol
+
+import (
+	"io"
+	"net"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+// 1000 个协程在同一连接上并发写出小帧，对比直接加锁写出与合并写
+func benchmarkConcurrentWrite(b *testing.B, batch bool) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		io.Copy(io.Discard, conn)
+	}()
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer conn.Close()
+
+	var mutex sync.Mutex
+	send := func(msg *RPCMsg) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return msg.Send(conn)
+	}
+	if batch {
+		writer := NewBatchWriter(conn, BatchOption{})
+		defer writer.Close()
+		send = writer.Write
+	}
+
+	b.ReportAllocs()
+	b.SetParallelism((1000 + runtime.GOMAXPROCS(0) - 1) / runtime.GOMAXPROCS(0))
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		msg := newBenchMsg(Version2, Request, make([]byte, 32))
+		for pb.Next() {
+			if err := send(msg); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkConcurrentWrite(b *testing.B)      { benchmarkConcurrentWrite(b, false) }
+func BenchmarkConcurrentWriteBatch(b *testing.B) { benchmarkConcurrentWrite(b, true) }
@@ -0,0 +1,113 @@
+package provider
+
+import (
+	"context"
+	"github.com/zhangweijie11/zRPC/global"
+	"github.com/zhangweijie11/zRPC/metadata"
+	"github.com/zhangweijie11/zRPC/protocol"
+	"github.com/zhangweijie11/zRPC/status"
+)
+
+// Callback 调用方客户端的句柄，通过它在请求所在的连接上反向调用客户端注册的回调服务，
+// 请求帧与响应帧的方向与普通调用相反。句柄在连接断开前一直有效，可保存下来在方法返回后推送通知。
+// 同一连接上使用相同序列化协议的请求得到同一个句柄，可作为客户端连接的标识
+type Callback struct {
+	rl            *RPCListener
+	sc            *serverConn
+	serializeType protocol.SerializeType // 与客户端请求使用相同的序列化协议
+}
+
+type callbackKey struct{}
+
+// CallbackFromContext 获取发起请求的客户端的句柄，只有 v2 连接上的请求可以反向调用
+func CallbackFromContext(ctx context.Context) (*Callback, bool) {
+	cb, ok := ctx.Value(callbackKey{}).(*Callback)
+	return cb, ok
+}
+
+// 获取连接上对应序列化协议的回调句柄
+func (rl *RPCListener) callback(sc *serverConn, serializeType protocol.SerializeType) *Callback {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	cb, ok := sc.handles[serializeType]
+	if !ok {
+		cb = &Callback{rl: rl, sc: sc, serializeType: serializeType}
+		sc.handles[serializeType] = cb
+	}
+	return cb
+}
+
+// Done 连接断开时关闭，之后的调用均返回 Unavailable
+func (cb *Callback) Done() <-chan struct{} {
+	return cb.sc.ctx.Done()
+}
+
+// Call 调用客户端回调服务 class 的 method 方法，等待客户端返回结果。ctx 中的元数据随请求发送
+func (cb *Callback) Call(ctx context.Context, class, method string, args ...interface{}) ([]interface{}, error) {
+	id, responses := cb.sc.registerCallback()
+	defer cb.sc.unregisterCallback(id)
+	msg, err := cb.newRequest(ctx, id, class, method, args)
+	if err != nil {
+		return nil, err
+	}
+	if err = cb.rl.writeMsg(cb.sc, msg); err != nil {
+		return nil, status.Errorf(status.Unavailable, "回调请求写出失败：%v", err)
+	}
+
+	var respMsg *protocol.RPCMsg
+	select {
+	case respMsg = <-responses:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-cb.sc.ctx.Done():
+		return nil, status.New(status.Unavailable, "客户端连接已断开！")
+	}
+	defer respMsg.Release()
+
+	if respMsg.MsgType() == protocol.Error {
+		return nil, status.Unmarshal(respMsg.Payload)
+	}
+	result := make([]interface{}, 0)
+	if err = global.Codecs[respMsg.SerializeType()].Decode(respMsg.Payload, &result); err != nil {
+		return nil, status.Errorf(status.Internal, "回调结果解码失败：%v", err)
+	}
+	return result, nil
+}
+
+// Notify 单向调用客户端回调服务 class 的 method 方法，请求写出后即返回
+func (cb *Callback) Notify(ctx context.Context, class, method string, args ...interface{}) error {
+	msg, err := cb.newRequest(ctx, cb.sc.nextCallbackID(), class, method, args)
+	if err != nil {
+		return err
+	}
+	msg.Flags |= protocol.OneWay
+	if err = cb.rl.writeMsg(cb.sc, msg); err != nil {
+		return status.Errorf(status.Unavailable, "回调请求写出失败：%v", err)
+	}
+	return nil
+}
+
+func (cb *Callback) newRequest(ctx context.Context, id uint64, class, method string, args []interface{}) (*protocol.RPCMsg, error) {
+	if cb.sc.ctx.Err() != nil {
+		return nil, status.New(status.Unavailable, "客户端连接已断开！")
+	}
+	payload, err := global.Codecs[cb.serializeType].Encode(args)
+	if err != nil {
+		return nil, status.Errorf(status.InvalidArgument, "回调参数编码失败：%v", err)
+	}
+
+	msg := protocol.NewRPCMsg()
+	msg.SetVersion(protocol.Version2)
+	msg.SetMsgType(protocol.Request)
+	msg.SetCompressType(protocol.None)
+	msg.SetSerializeType(cb.serializeType)
+	msg.RequestID = id
+	msg.ServiceClass = class
+	msg.ServiceMethod = method
+	msg.Payload = payload
+	if md, ok := metadata.FromOutgoingContext(ctx); ok {
+		msg.Metadata = md
+	}
+	return msg, nil
+}
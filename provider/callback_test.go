@@ -0,0 +1,84 @@
+package provider_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/zhangweijie11/zRPC/consumer"
+	"github.com/zhangweijie11/zRPC/provider"
+	"github.com/zhangweijie11/zRPC/status"
+	"github.com/zhangweijie11/zRPC/zrpctest"
+)
+
+// Job 处理中通过回调向客户端报告进度
+type Job struct{}
+
+func (j *Job) Run(ctx context.Context, steps int) (string, error) {
+	cb, ok := provider.CallbackFromContext(ctx)
+	if !ok {
+		return "", status.New(status.FailedPrecondition, "no callback")
+	}
+	acks := ""
+	for i := 1; i <= steps; i++ {
+		res, err := cb.Call(ctx, "Progress", "Report", i)
+		if err != nil {
+			return "", err
+		}
+		acks += fmt.Sprint(res[0])
+	}
+	return acks, nil
+}
+
+type Progress struct {
+	steps []int
+}
+
+func (p *Progress) Report(ctx context.Context, step int) (string, error) {
+	p.steps = append(p.steps, step)
+	return fmt.Sprintf("[%d]", step), nil
+}
+
+// 处理方法在请求所在的连接上回调客户端，得到回调结果后返回
+func TestCallback(t *testing.T) {
+	srv := zrpctest.NewServer(zrpctest.Config{}, func(rs *provider.RPCServer) {
+		rs.Register(&Job{})
+	})
+	defer srv.Close()
+
+	cli, err := srv.NewClient(consumer.DefaultOption)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+	progress := &Progress{}
+	cli.RegisterCallback("Progress", progress)
+
+	res, err := cli.Call(context.Background(), &consumer.Service{Class: "Job", Method: "Run"}, []interface{}{3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) == 0 || res[0] != "[1][2][3]" {
+		t.Fatalf("Run = %v, want [1][2][3]", res)
+	}
+	if fmt.Sprint(progress.steps) != "[1 2 3]" {
+		t.Fatalf("callback received steps %v, want [1 2 3]", progress.steps)
+	}
+}
+
+// 客户端未注册回调服务时，回调错误返回给处理方法
+func TestCallbackUnregistered(t *testing.T) {
+	srv := zrpctest.NewServer(zrpctest.Config{}, func(rs *provider.RPCServer) {
+		rs.Register(&Job{})
+	})
+	defer srv.Close()
+
+	cli, err := srv.NewClient(consumer.DefaultOption)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+	if _, err = cli.Call(context.Background(), &consumer.Service{Class: "Job", Method: "Run"}, []interface{}{1}); err == nil {
+		t.Fatal("Run succeeded without a registered callback")
+	}
+}
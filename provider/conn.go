@@ -0,0 +1,247 @@
+package provider
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"github.com/zhangweijie11/zRPC/protocol"
+	"net"
+	"sync"
+	"time"
+)
+
+// serverConn 服务端连接及其请求处理状态。v1 连接上的请求串行处理，
+// v2 连接按请求 ID 并发处理，写入需持有 writeMutex 以免多个响应交错
+type serverConn struct {
+	net.Conn
+	tlsConn    *tls.Conn // 接入插件包装连接前的 TLS 连接，未使用 TLS 时为 nil
+	writeMutex sync.Mutex
+	writer     *protocol.BatchWriter // 合并写，未开启时为 nil
+	ctx        context.Context       // 连接关闭时取消，所有请求的上下文由此派生
+	cancel     context.CancelFunc    // 取消 ctx
+
+	mutex    sync.Mutex
+	version  byte                          // 协商的协议版本，未握手时为 v1
+	inflight int                           // 处理中的请求数
+	pending  int                           // 等待并发许可的请求数
+	goAway   bool                          // 是否已发送 GoAway
+	cancels  map[uint64]context.CancelFunc // 处理中请求的取消函数，按请求 ID 索引，v1 请求 ID 均为 0
+	streams  map[uint64]*protocol.Stream   // 处理中的流，按请求 ID 索引
+
+	callbacks  map[uint64]chan *protocol.RPCMsg     // 等待客户端响应的回调，按回调请求 ID 索引
+	callbackID uint64                               // 最近分配的回调请求 ID，与客户端的请求 ID 相互独立，按帧的方向区分
+	handles    map[protocol.SerializeType]*Callback // 按序列化协议复用的回调句柄
+}
+
+func newServerConn(conn net.Conn, tlsConn *tls.Conn) *serverConn {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &serverConn{
+		Conn:    conn,
+		tlsConn: tlsConn,
+		ctx:     ctx,
+		cancel:  cancel,
+		version: protocol.Version1,
+		cancels: make(map[uint64]context.CancelFunc),
+		streams: make(map[uint64]*protocol.Stream),
+
+		callbacks: make(map[uint64]chan *protocol.RPCMsg),
+		handles:   make(map[protocol.SerializeType]*Callback),
+	}
+}
+
+// 协商的协议版本
+func (sc *serverConn) getVersion() byte {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+	return sc.version
+}
+
+func (sc *serverConn) setVersion(version byte) {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+	sc.version = version
+}
+
+// 开始处理请求，返回请求的上下文。已发送 GoAway 时返回 false，请求不再处理
+func (sc *serverConn) begin(msg *protocol.RPCMsg) (context.Context, bool) {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	if sc.goAway {
+		return nil, false
+	}
+	sc.inflight++
+	ctx, cancel := context.WithCancel(sc.ctx)
+	sc.cancels[msg.RequestID] = cancel
+	return ctx, true
+}
+
+// 请求处理结束，服务关闭中时发送 GoAway，返回连接是否继续可用。
+// 连接不再可用时中断阻塞的读取，由读取协程关闭连接
+func (sc *serverConn) end(msg *protocol.RPCMsg, shutdown bool, sendGoAway func(*serverConn) error) bool {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	sc.inflight--
+	if cancel, ok := sc.cancels[msg.RequestID]; ok {
+		cancel()
+		delete(sc.cancels, msg.RequestID)
+	}
+	if shutdown && !sc.goAway {
+		sc.goAway = true
+		sendGoAway(sc)
+	}
+	if sc.goAway && sc.inflight == 0 {
+		sc.Conn.SetReadDeadline(time.Now())
+		return false
+	}
+	return !sc.goAway
+}
+
+// 在等待并发许可的队列中占一个位置，队列已满时返回 false
+func (sc *serverConn) reservePending(limit int) bool {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	if sc.pending >= limit {
+		return false
+	}
+	sc.pending++
+	return true
+}
+
+func (sc *serverConn) releasePending() {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+	sc.pending--
+}
+
+// 取消 v2 请求 ID 对应的处理中请求
+func (sc *serverConn) cancelRequest(id uint64) {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	if cancel, ok := sc.cancels[id]; ok {
+		cancel()
+		delete(sc.cancels, id)
+	}
+}
+
+func (sc *serverConn) addStream(stream *protocol.Stream) {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+	sc.streams[stream.ID()] = stream
+}
+
+func (sc *serverConn) getStream(id uint64) *protocol.Stream {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+	return sc.streams[id]
+}
+
+func (sc *serverConn) removeStream(id uint64) {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+	delete(sc.streams, id)
+}
+
+// 登记一次回调，返回分配的回调请求 ID 及接收响应的通道
+func (sc *serverConn) registerCallback() (uint64, chan *protocol.RPCMsg) {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	sc.callbackID++
+	ch := make(chan *protocol.RPCMsg, 1)
+	sc.callbacks[sc.callbackID] = ch
+	return sc.callbackID, ch
+}
+
+// 分配不需要等待响应的回调请求 ID
+func (sc *serverConn) nextCallbackID() uint64 {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	sc.callbackID++
+	return sc.callbackID
+}
+
+func (sc *serverConn) unregisterCallback(id uint64) {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+	delete(sc.callbacks, id)
+}
+
+// 将客户端的回调响应交给等待中的回调，没有等待中的回调时丢弃
+func (sc *serverConn) deliverCallback(msg *protocol.RPCMsg) {
+	sc.mutex.Lock()
+	ch, ok := sc.callbacks[msg.RequestID]
+	sc.mutex.Unlock()
+	if !ok {
+		msg.Release()
+		return
+	}
+	select {
+	case ch <- msg:
+	default:
+		msg.Release()
+	}
+}
+
+// 通知连接进入关闭流程：v1 连接空闲时立即发送 GoAway 并中断阻塞的读取，处理中时在当前请求结束后由 end 发送；
+// v2 连接立即发送 GoAway，处理中的请求完成后再关闭连接
+func (sc *serverConn) drain(sendGoAway func(*serverConn) error) {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	if sc.goAway || (sc.inflight > 0 && sc.version < protocol.Version2) {
+		return
+	}
+	sc.goAway = true
+	sendGoAway(sc)
+	if sc.inflight == 0 {
+		sc.Conn.SetReadDeadline(time.Now())
+	}
+}
+
+// frameReader 为每一帧的读取设置超时：等待首字节时连接处于空闲状态，不限时；
+// 收到首字节后帧头需在 headerTimeout 内读完，防止慢速攻击长期占用连接；帧头之后的消息体需在 readTimeout 内读完。
+// 数据经 src 缓冲读取，连续到达的多帧只需一次系统调用，超时仍设置在 conn 上
+type frameReader struct {
+	conn          net.Conn
+	src           *bufio.Reader
+	headerTimeout time.Duration
+	readTimeout   time.Duration
+	read          int // 当前帧已读取的字节数
+}
+
+// 开始读取新的一帧
+func (fr *frameReader) reset() {
+	fr.read = 0
+}
+
+// 是否仍在读取帧头
+func (fr *frameReader) inHeader() bool {
+	return fr.read < protocol.FrameHeaderLen
+}
+
+func (fr *frameReader) Read(p []byte) (int, error) {
+	// 帧头按字节边界读取，以便在首字节和帧头读完时切换超时
+	if fr.read == 0 {
+		p = p[:1]
+	} else if fr.inHeader() && len(p) > protocol.FrameHeaderLen-fr.read {
+		p = p[:protocol.FrameHeaderLen-fr.read]
+	}
+
+	n, err := fr.src.Read(p)
+	if n == 0 {
+		return n, err
+	}
+	if fr.read == 0 && fr.headerTimeout > 0 {
+		fr.conn.SetReadDeadline(time.Now().Add(fr.headerTimeout))
+	}
+	fr.read += n
+	if fr.read == protocol.FrameHeaderLen && fr.readTimeout > 0 {
+		fr.conn.SetReadDeadline(time.Now().Add(fr.readTimeout))
+	}
+	return n, err
+}
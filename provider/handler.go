@@ -1,25 +1,132 @@
 package provider
 
-import "reflect"
+import (
+	"context"
+	"fmt"
+	"github.com/zhangweijie11/zRPC/status"
+	"reflect"
+)
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
 
 type Handler interface {
-	Handle(string, []interface{}) ([]interface{}, error)
+	Handle(context.Context, string, []interface{}) ([]interface{}, error)
+}
+
+// 支持流式方法的处理器
+type streamHandler interface {
+	StreamKind(string) StreamKind
+	handleStream(context.Context, string, []interface{}, *serverStream) ([]interface{}, error)
+}
+
+// 可确认方法是否存在的处理器，用于在获取并发许可前拒绝不存在的方法
+type methodHandler interface {
+	HasMethod(string) bool
 }
 
 // RPCServerHandler RPC 服务处理器
 type RPCServerHandler struct {
-	rpcServer *RPCServer
-	class     reflect.Value
+	rpcServer    *RPCServer
+	name         string
+	class        reflect.Value
+	kinds        map[string]StreamKind // 流式方法的调用方式，注册时根据方法签名生成
+	interceptors []Interceptor         // 仅作用于该服务的拦截器
+}
+
+// 初始化服务处理器，流式方法的签名不合法时返回错误
+func newRPCServerHandler(name string, class interface{}, interceptors []Interceptor) (*RPCServerHandler, error) {
+	handler := &RPCServerHandler{
+		name:         name,
+		class:        reflect.ValueOf(class),
+		kinds:        make(map[string]StreamKind),
+		interceptors: interceptors,
+	}
+	classType := handler.class.Type()
+	for i := 0; i < classType.NumMethod(); i++ {
+		method := classType.Method(i)
+		kind, err := streamKindOf(handler.class.Method(i).Type())
+		if err != nil {
+			return nil, fmt.Errorf("方法 %s.%s 签名不合法：%v", name, method.Name, err)
+		}
+		if kind != Unary {
+			handler.kinds[method.Name] = kind
+		}
+	}
+	return handler, nil
+}
+
+// StreamKind 方法的调用方式
+func (handler *RPCServerHandler) StreamKind(method string) StreamKind {
+	return handler.kinds[method]
+}
+
+// HasMethod 方法是否存在
+func (handler *RPCServerHandler) HasMethod(method string) bool {
+	return handler.class.MethodByName(method).IsValid()
 }
 
 // Handle 处理器
-func (handler *RPCServerHandler) Handle(method string, params []interface{}) ([]interface{}, error) {
-	args := make([]reflect.Value, len(params))
-	for i := range args {
-		args[i] = reflect.ValueOf(params[i])
+func (handler *RPCServerHandler) Handle(ctx context.Context, method string, params []interface{}) ([]interface{}, error) {
+	info := &MethodInfo{Class: handler.name, Method: method}
+	call := func(ctx context.Context, params []interface{}) ([]interface{}, error) {
+		return handler.call(ctx, method, params)
+	}
+
+	return chainInterceptors(handler.interceptors, info, call)(ctx, params)
+}
+
+// 处理流式方法，拦截器的参数为请求参数，结果为方法的返回值。
+// 接收客户端数据的方法先向客户端授予额度；客户端流方法返回后将结果作为一条数据发送给客户端
+func (handler *RPCServerHandler) handleStream(ctx context.Context, method string, params []interface{}, ss *serverStream) ([]interface{}, error) {
+	kind := handler.kinds[method]
+	info := &MethodInfo{Class: handler.name, Method: method}
+	call := func(ctx context.Context, params []interface{}) ([]interface{}, error) {
+		ss.ctx = ctx
+		if kind.receives() {
+			if err := ss.stream.Open(); err != nil {
+				return nil, err
+			}
+		}
+		reflectMethod := handler.class.MethodByName(method)
+		streamType := reflectMethod.Type().In(reflectMethod.Type().NumIn() - 1)
+		return handler.invoke(ctx, reflectMethod, params, newStreamArg(streamType, ss))
 	}
 
+	result, err := chainInterceptors(handler.interceptors, info, call)(ctx, params)
+	if err != nil || kind != ClientStreamMethod {
+		return result, err
+	}
+	if len(result) == 0 {
+		return nil, status.Errorf(status.Internal, "方法 %s 未返回结果！", method)
+	}
+	return result, ss.send(result[0])
+}
+
+// 通过反射调用方法，方法第一个参数为 context.Context 时自动传入调用上下文
+func (handler *RPCServerHandler) call(ctx context.Context, method string, params []interface{}) ([]interface{}, error) {
 	reflectMethod := handler.class.MethodByName(method)
+	if !reflectMethod.IsValid() {
+		return nil, status.Errorf(status.NotFound, "方法 %s 不存在！", method)
+	}
+	if handler.kinds[method] != Unary {
+		return nil, status.Errorf(status.Unimplemented, "方法 %s 为流式方法，需以流式调用！", method)
+	}
+	return handler.invoke(ctx, reflectMethod, params)
+}
+
+// 按参数调用方法，extra 追加在请求参数之后
+func (handler *RPCServerHandler) invoke(ctx context.Context, reflectMethod reflect.Value, params []interface{}, extra ...reflect.Value) ([]interface{}, error) {
+	args := make([]reflect.Value, 0, len(params)+len(extra)+1)
+	if methodType := reflectMethod.Type(); methodType.NumIn() > 0 && methodType.In(0) == contextType {
+		args = append(args, reflect.ValueOf(&ctx).Elem())
+	}
+	for i := range params {
+		args = append(args, reflect.ValueOf(params[i]))
+	}
+	args = append(args, extra...)
 
 	result := reflectMethod.Call(args)
 
@@ -30,6 +137,9 @@ func (handler *RPCServerHandler) Handle(method string, params []interface{}) ([]
 
 	var err error
 
+	if len(result) == 0 {
+		return resArgs, nil
+	}
 	if _, ok := result[len(result)-1].Interface().(error); ok {
 		err = result[len(result)-1].Interface().(error)
 	}
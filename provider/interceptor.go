@@ -0,0 +1,27 @@
+package provider
+
+import "context"
+
+// MethodInfo 被调用方法的信息
+type MethodInfo struct {
+	Class  string // 服务名
+	Method string // 方法名
+}
+
+// UnaryHandler 执行一次方法调用
+type UnaryHandler func(ctx context.Context, args []interface{}) ([]interface{}, error)
+
+// Interceptor 服务端拦截器，包裹方法调用，可修改参数和结果、统计耗时，
+// 不调用 next 时直接中断调用并返回自身的结果，可用于鉴权、校验、缓存等
+type Interceptor func(ctx context.Context, info *MethodInfo, args []interface{}, next UnaryHandler) ([]interface{}, error)
+
+// 按注册顺序组合拦截器，先注册的拦截器位于外层
+func chainInterceptors(interceptors []Interceptor, info *MethodInfo, handler UnaryHandler) UnaryHandler {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], handler
+		handler = func(ctx context.Context, args []interface{}) ([]interface{}, error) {
+			return interceptor(ctx, info, args, next)
+		}
+	}
+	return handler
+}
@@ -0,0 +1,74 @@
+package provider_test
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/zhangweijie11/zRPC/consumer"
+	"github.com/zhangweijie11/zRPC/provider"
+	"github.com/zhangweijie11/zRPC/zrpctest"
+)
+
+// 记录拦截器及方法的执行顺序
+type tracer struct {
+	mutex sync.Mutex
+	trace []string
+}
+
+func (tr *tracer) add(event string) {
+	tr.mutex.Lock()
+	defer tr.mutex.Unlock()
+	tr.trace = append(tr.trace, event)
+}
+
+func (tr *tracer) interceptor(name string) provider.Interceptor {
+	return func(ctx context.Context, info *provider.MethodInfo, args []interface{}, next provider.UnaryHandler) ([]interface{}, error) {
+		tr.add(name + " before " + info.Class + "." + info.Method)
+		result, err := next(ctx, args)
+		tr.add(name + " after")
+		return result, err
+	}
+}
+
+type Traced struct {
+	tracer *tracer
+}
+
+func (t *Traced) Do(ctx context.Context) (int, error) {
+	t.tracer.add("call")
+	return 1, nil
+}
+
+// 全局拦截器位于服务拦截器外层，各自按注册顺序由外到内执行
+func TestInterceptorOrder(t *testing.T) {
+	tr := &tracer{}
+	srv := zrpctest.NewServer(zrpctest.Config{}, func(rs *provider.RPCServer) {
+		rs.Use(tr.interceptor("global1"), tr.interceptor("global2"))
+		rs.Register(&Traced{tracer: tr}, tr.interceptor("service1"), tr.interceptor("service2"))
+	})
+	defer srv.Close()
+
+	cli, err := srv.NewClient(consumer.DefaultOption)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+	if _, err = cli.Call(context.Background(), &consumer.Service{Class: "Traced", Method: "Do"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"global1 before Traced.Do", "global2 before Traced.Do",
+		"service1 before Traced.Do", "service2 before Traced.Do",
+		"call",
+		"service2 after", "service1 after",
+		"global2 after", "global1 after",
+	}
+	tr.mutex.Lock()
+	defer tr.mutex.Unlock()
+	if !reflect.DeepEqual(tr.trace, want) {
+		t.Fatalf("trace = %v, want %v", tr.trace, want)
+	}
+}
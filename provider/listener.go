@@ -1,33 +1,66 @@
 package provider
 
 import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
-	"github.com/zhangweijie11/zRPC/config"
 	"github.com/zhangweijie11/zRPC/global"
+	"github.com/zhangweijie11/zRPC/metadata"
 	"github.com/zhangweijie11/zRPC/protocol"
+	"github.com/zhangweijie11/zRPC/status"
+	"github.com/zhangweijie11/zRPC/transport"
 	"io"
 	"log"
 	"net"
+	"runtime/debug"
+	"sync"
 	"sync/atomic"
+	"time"
 )
 
 type Listener interface {
 	Run()
 	SetHandler(string, Handler)
+	SetPlugins(PluginContainer)
+	Use(...Interceptor)
 	Close()
 	GetAddrs() []string
-	Shutdown()
+	Violations() Violations
+	Shutdown(context.Context) error
 }
 
+// Violations 连接违规计数，违规的连接会被关闭
+type Violations struct {
+	FrameTooLarge int64 // 消息体超过最大长度
+	NameTooLong   int64 // 服务名或方法名超过最大长度
+	Malformed     int64 // 帧格式错误，如校验值错误、消息不完整、协议版本不支持
+	HeaderTimeout int64 // 帧头未在规定时间内读完
+	ReadTimeout   int64 // 消息体未在规定时间内读完
+}
+
+// 优雅关闭时检查连接是否全部关闭的间隔
+const shutdownPollInterval = 10 * time.Millisecond
+
 // RPCListener RPC 服务监听器
 type RPCListener struct {
-	ServiceIP   string
-	ServicePort int
-	Handlers    map[string]Handler
-	netListener net.Listener
-	doneChan    chan struct{}
-	shutdown    int32 // 关闭处理中标识位
-	handlingNum int32 // 处理中任务数
+	ServiceIP    string
+	ServicePort  int
+	Handlers     map[string]Handler
+	plugins      PluginContainer
+	option       Option
+	interceptors []Interceptor // 作用于所有服务的拦截器
+	netListener  net.Listener
+	pool         *workerPool
+	limits       *concurrencyLimits
+	connMutex    sync.Mutex
+	conns        map[net.Conn]*serverConn // 活跃连接
+	frameLimits  protocol.Limits
+	violations   Violations
+	doneChan     chan struct{}
+	shutdown     int32 // 关闭处理中标识位
+	handlingNum  int32 // 处理中任务数
 }
 
 // NewRPCListener 初始化监听器
@@ -36,19 +69,46 @@ func NewRPCListener(option Option) *RPCListener {
 		ServiceIP:   option.Ip,
 		ServicePort: option.Port,
 		Handlers:    make(map[string]Handler),
+		option:      option,
+		plugins:     NewPluginContainer(),
 		netListener: nil,
+		limits:      newConcurrencyLimits(option),
+		conns:       make(map[net.Conn]*serverConn),
+		doneChan:    make(chan struct{}),
+		frameLimits: frameLimits(option),
+	}
+}
+
+// 按配置生成解码长度限制，未配置时使用默认值
+func frameLimits(option Option) protocol.Limits {
+	limits := protocol.DefaultLimits
+	if option.MaxFrameSize > 0 {
+		limits.MaxBodyLen = uint32(option.MaxFrameSize)
 	}
+	if option.MaxNameLen > 0 {
+		limits.MaxNameLen = uint32(option.MaxNameLen)
+	}
+	return limits
 }
 
 // Run 启动监听器
 func (rl *RPCListener) Run() {
-	addr := fmt.Sprintf("%s:%d", rl.ServiceIP, rl.ServicePort)
-
-	netListener, err := net.Listen("tcp", addr)
+	trans, err := rl.transport()
 	if err != nil {
 		panic(err)
 	}
+	netListener, err := trans.Listen(rl.listenAddr())
+	if err != nil {
+		panic(err)
+	}
+	if rl.option.TLSConfig != nil {
+		// 握手在连接的处理协程中进行，不阻塞接收新连接
+		netListener = tls.NewListener(netListener, rl.option.TLSConfig)
+	}
 	rl.netListener = netListener
+	if rl.option.Workers > 0 {
+		rl.pool = newWorkerPool(rl.option.Workers, rl.option.QueueSize, rl.option.MaxQueueWait)
+	}
 
 	go rl.acceptConn()
 
@@ -61,11 +121,33 @@ func (rl *RPCListener) Run() {
 	//}
 }
 
+// 配置的传输方式，未配置时按 NetProtocol 选择，默认为 TCP
+func (rl *RPCListener) transport() (transport.Transport, error) {
+	if rl.option.Transport != nil {
+		return rl.option.Transport, nil
+	}
+	if rl.option.NetProtocol == "" {
+		return transport.TCP{}, nil
+	}
+	return transport.Get(rl.option.NetProtocol)
+}
+
+// 监听地址，未配置 Address 时为 Ip:Port
+func (rl *RPCListener) listenAddr() string {
+	if rl.option.Address != "" {
+		return rl.option.Address
+	}
+	return fmt.Sprintf("%s:%d", rl.ServiceIP, rl.ServicePort)
+}
+
 // Close 关闭监听器
 func (rl *RPCListener) Close() {
 	if rl.netListener != nil {
 		rl.netListener.Close()
 	}
+	if rl.pool != nil {
+		rl.pool.stop()
+	}
 }
 
 // SetHandler 设置处理器
@@ -78,97 +160,631 @@ func (rl *RPCListener) SetHandler(name string, handler Handler) {
 	rl.Handlers[name] = handler
 }
 
+// SetPlugins 设置插件容器
+func (rl *RPCListener) SetPlugins(plugins PluginContainer) {
+	rl.plugins = plugins
+}
+
+// Use 注册作用于所有服务的拦截器
+func (rl *RPCListener) Use(interceptors ...Interceptor) {
+	rl.interceptors = append(rl.interceptors, interceptors...)
+}
+
 // CloseConn 关闭服务链接
 func (rl *RPCListener) CloseConn(conn net.Conn) {
-	//activeconn
+	rl.connMutex.Lock()
+	delete(rl.conns, conn)
+	rl.connMutex.Unlock()
 	conn.Close()
 
-	//plugin
+	if err := rl.plugins.ConnCloseHook(conn); err != nil {
+		log.Printf("连接关闭插件异常：%v\n", err)
+	}
 	log.Println("服务关闭！")
 }
 
 // 处理服务链接
-func (rl *RPCListener) handleConn(conn net.Conn) {
-	// 关闭挡板
-	if rl.isShutdown() {
-		return
-	}
-
+func (rl *RPCListener) handleConn(sc *serverConn) {
+	conn := sc.Conn
 	defer func() {
 		if err := recover(); err != nil {
 			log.Printf("服务 %s 异常r:%s\n", conn.RemoteAddr(), err)
 		}
+		sc.cancel()
+		if sc.writer != nil {
+			sc.writer.Close()
+		}
 		rl.CloseConn(conn)
 	}()
-	for {
 
-		//关闭挡板
-		if rl.isShutdown() {
+	// 关闭挡板
+	if rl.isShutdown() {
+		return
+	}
+	if !rl.accept(sc) {
+		return
+	}
+
+	reader := &frameReader{conn: conn, src: bufio.NewReader(conn), headerTimeout: rl.option.HeaderTimeout, readTimeout: rl.option.ReadTimeout}
+	for {
+		// 读取前插件返回错误时尚未读到请求，只能关闭连接
+		if err := rl.plugins.BeforeReadHook(); err != nil {
+			log.Printf("读取前插件异常，关闭连接：%v\n", err)
 			return
 		}
 
-		//处理中任务数+1
-		atomic.AddInt32(&rl.handlingNum, 1)
-		//任意退出都会导致处理中任务数-1
-		defer atomic.AddInt32(&rl.handlingNum, -1)
-
-		msg, err := rl.receiveData(conn)
+		msg, err := rl.receiveData(conn, reader)
+		hookErr := rl.plugins.AfterReadHook(msg, err)
 		if err != nil || msg == nil {
 			return
 		}
+		// 一帧读取完成，清除读超时，等待下一帧时连接处于空闲状态
+		conn.SetReadDeadline(time.Time{})
 
-		coder := global.Codecs[msg.Header.SerializeType()]
-		if coder == nil {
+		switch msg.MsgType() {
+		case protocol.Handshake:
+			err = rl.handshake(sc, msg)
+			msg.Release()
+			if err != nil {
+				return
+			}
+			continue
+		case protocol.Cancel:
+			sc.cancelRequest(msg.RequestID)
+			msg.Release()
+			continue
+		case protocol.StreamData, protocol.StreamEnd, protocol.StreamError, protocol.WindowUpdate:
+			rl.deliverStream(sc, msg)
+			continue
+		case protocol.Response, protocol.Error:
+			// 客户端对回调请求的响应
+			sc.deliverCallback(msg)
+			continue
+		}
+
+		ctx, ok := sc.begin(msg)
+		if !ok {
+			// 已发送 GoAway，之后收到的请求不再处理，客户端可安全地重试到其他服务端。
+			// v1 无法区分请求，只能关闭连接；v2 按请求 ID 返回错误，等待处理中的请求完成
+			if msg.Version() < protocol.Version2 {
+				return
+			}
+			err = rl.sendError(sc, msg, status.New(status.Unavailable, "服务端正在关闭，请求未处理！"))
+			msg.Release()
+			if err != nil {
+				return
+			}
+			continue
+		}
+
+		if msg.Version() >= protocol.Version2 {
+			// v2 请求可通过上下文中的句柄反向调用客户端
+			ctx = context.WithValue(ctx, callbackKey{}, rl.callback(sc, msg.SerializeType()))
+		}
+
+		// v2 请求并发处理，v1 请求在读取协程中依次处理
+		if msg.Version() >= protocol.Version2 && msg.Flags.Has(protocol.Streaming) {
+			// 流需在读取下一帧之前登记，以便接收客户端随后发来的流帧
+			stream := protocol.NewStream(msg.RequestID, msg.Version(), msg.SerializeType(), rl.option.StreamWindow,
+				func(frame *protocol.RPCMsg) error { return rl.writeMsg(sc, frame) })
+			sc.addStream(stream)
+			rl.serveStream(sc, ctx, msg, hookErr, stream)
+			continue
+		}
+		if msg.Version() >= protocol.Version2 {
+			rl.serveAsync(sc, ctx, msg, hookErr)
+			continue
+		}
+		err = rl.serve(sc, ctx, msg, hookErr, rl.dispatch)
+		msg.Release()
+		if !sc.end(msg, rl.isShutdown(), rl.sendGoAway) || err != nil {
 			return
 		}
-		inArgs := make([]interface{}, 0)
-		err = coder.Decode(msg.Payload, &inArgs)
+	}
+}
+
+// 完成 TLS 握手并通知插件对端信息，对端信息随连接的上下文传给所有请求。握手需在帧头超时内完成
+func (rl *RPCListener) accept(sc *serverConn) bool {
+	if tlsConn := sc.tlsConn; tlsConn != nil {
+		if rl.option.HeaderTimeout > 0 {
+			tlsConn.SetDeadline(time.Now().Add(rl.option.HeaderTimeout))
+		}
+		err := tlsConn.Handshake()
+		tlsConn.SetDeadline(time.Time{})
 		if err != nil {
-			return
+			log.Printf("连接 %s TLS 握手失败：%v\n", sc.RemoteAddr(), err)
+			return false
 		}
-		handler, ok := rl.Handlers[msg.ServiceClass]
-		if !ok {
+	}
+
+	peer := newPeer(sc.Conn, sc.tlsConn)
+	if err := rl.plugins.PeerHook(peer); err != nil {
+		log.Printf("拒绝连接 %s：%v\n", sc.RemoteAddr(), err)
+		return false
+	}
+	// 连接尚未开始处理请求，其他协程还不会读取 ctx
+	sc.ctx = context.WithValue(sc.ctx, peerKey{}, peer)
+	return true
+}
+
+// 将客户端发来的流帧投递到对应的流，超过流控窗口时取消该流
+func (rl *RPCListener) deliverStream(sc *serverConn, msg *protocol.RPCMsg) {
+	stream := sc.getStream(msg.RequestID)
+	if stream == nil {
+		// 流已结束，丢弃
+		msg.Release()
+		return
+	}
+	if err := stream.Deliver(msg); err != nil {
+		log.Printf("流 %d 异常，取消：%v\n", msg.RequestID, err)
+		stream.Close(status.New(status.ResourceExhausted, err.Error()))
+		sc.cancelRequest(msg.RequestID)
+	}
+}
+
+// 协商协议版本，回复双方都支持的最高版本
+func (rl *RPCListener) handshake(sc *serverConn, msg *protocol.RPCMsg) error {
+	version := protocol.Negotiate(msg.Payload, rl.maxVersion())
+	sc.setVersion(version)
+
+	resMsg := protocol.NewHandshake([]byte{version})
+	return rl.writeMsg(sc, resMsg)
+}
+
+// 服务端支持的最高协议版本
+func (rl *RPCListener) maxVersion() byte {
+	if rl.option.ProtocolVersion == 0 {
+		return protocol.MaxVersion
+	}
+	return rl.option.ProtocolVersion
+}
+
+// 并发处理 v2 请求。获取并发许可后提交到工作池，未配置工作池时在独立协程中处理，工作池已满时直接拒绝
+func (rl *RPCListener) serveAsync(sc *serverConn, ctx context.Context, msg *protocol.RPCMsg, hookErr error) {
+	if hookErr != nil {
+		rl.runAsync(sc, ctx, msg, hookErr, func() {})
+		return
+	}
+	rl.admit(sc, msg, func(release func(), err error) {
+		if err != nil {
+			rl.rejectAsync(sc, msg, err)
 			return
 		}
-		result, err := handler.Handle(msg.ServiceMethod, inArgs)
-		encodeRes, err := coder.Encode(result)
+		rl.runAsync(sc, ctx, msg, nil, release)
+	})
+}
+
+// 为 v2 请求获取并发许可，不阻塞连接的读取协程，以免读取不到处理中请求的取消帧、流帧及回调响应。
+// 许可不足且配置了 MaxQueueWait 时，请求进入连接的等待队列，由独立协程等待许可；等待队列已满时直接拒绝。
+// 获取的结果交给 admitted 处理
+func (rl *RPCListener) admit(sc *serverConn, msg *protocol.RPCMsg, admitted func(release func(), err error)) {
+	release, err := rl.acquire(msg, 0)
+	if status.CodeOf(err) != status.ResourceExhausted || rl.option.MaxQueueWait <= 0 {
+		admitted(release, err)
+		return
+	}
+	if !sc.reservePending(rl.maxPendingRequests()) {
+		admitted(nil, status.New(status.ResourceExhausted, "等待并发许可的请求过多！"))
+		return
+	}
+	go func() {
+		defer sc.releasePending()
+		admitted(rl.acquire(msg, rl.option.MaxQueueWait))
+	}()
+}
+
+// 每个连接上等待并发许可的最大请求数
+func (rl *RPCListener) maxPendingRequests() int {
+	if rl.option.MaxPendingRequests > 0 {
+		return rl.option.MaxPendingRequests
+	}
+	return defaultMaxPendingRequests
+}
+
+// 在工作池或独立协程中处理已获取许可的 v2 请求，写回失败时关闭连接
+func (rl *RPCListener) runAsync(sc *serverConn, ctx context.Context, msg *protocol.RPCMsg, hookErr error, release func()) {
+	run := func() {
+		defer func() {
+			if err := recover(); err != nil {
+				log.Printf("服务 %s 异常r:%s\n", sc.RemoteAddr(), err)
+				sc.Close()
+			}
+		}()
+		defer release()
+
+		err := rl.serve(sc, ctx, msg, hookErr, rl.process)
+		msg.Release()
+		sc.end(msg, rl.isShutdown(), rl.sendGoAway)
 		if err != nil {
-			return
+			sc.Close()
 		}
-		err = rl.sendData(conn, encodeRes)
+	}
+	if rl.pool == nil {
+		go run()
+		return
+	}
+	reject := func(err error) {
+		release()
+		rl.rejectAsync(sc, msg, err)
+	}
+	if err := rl.pool.submit(run, reject); err != nil {
+		reject(err)
+	}
+}
+
+// 拒绝 v2 请求并结束该请求，单向调用不返回错误。写回失败时关闭连接
+func (rl *RPCListener) rejectAsync(sc *serverConn, msg *protocol.RPCMsg, err error) {
+	log.Printf("拒绝请求 %s.%s：%v\n", msg.ServiceClass, msg.ServiceMethod, err)
+	var writeErr error
+	if !msg.Flags.Has(protocol.OneWay) {
+		writeErr = rl.sendError(sc, msg, err)
+	}
+	msg.Release()
+	sc.end(msg, rl.isShutdown(), rl.sendGoAway)
+	if writeErr != nil {
+		sc.Close()
+	}
+}
+
+// 处理一次请求，统计处理中的请求数。call 执行调用并返回编码后的结果
+func (rl *RPCListener) serve(sc *serverConn, ctx context.Context, msg *protocol.RPCMsg, hookErr error, call callFunc) error {
+	atomic.AddInt32(&rl.handlingNum, 1)
+	defer atomic.AddInt32(&rl.handlingNum, -1)
+
+	// 插件拒绝请求时返回错误响应，连接继续可用
+	if hookErr != nil {
+		return rl.sendError(sc, msg, pluginError(hookErr))
+	}
+	if msg.Flags.Has(protocol.OneWay) {
+		rl.handleOneWay(ctx, msg, call)
+		return nil
+	}
+	return rl.handleMsg(sc, ctx, msg, call)
+}
+
+// 执行调用并返回编码后的结果
+type callFunc func(context.Context, *protocol.RPCMsg) ([]byte, error)
+
+// 记录活跃连接，超过最大连接数时返回 nil
+func (rl *RPCListener) trackConn(conn net.Conn, tlsConn *tls.Conn) *serverConn {
+	rl.connMutex.Lock()
+	defer rl.connMutex.Unlock()
+
+	if rl.option.MaxConns > 0 && len(rl.conns) >= rl.option.MaxConns {
+		return nil
+	}
+	sc := newServerConn(conn, tlsConn)
+	if rl.option.WriteBatch {
+		sc.writer = protocol.NewBatchWriter(conn, protocol.BatchOption{
+			BufferSize:   rl.option.WriteBufferSize,
+			MaxDelay:     rl.option.WriteBatchDelay,
+			WriteTimeout: rl.option.WriteTimeout,
+		})
+	}
+	rl.conns[conn] = sc
+	return sc
+}
+
+// 处理一次请求并写回响应，只有写回失败时返回错误
+func (rl *RPCListener) handleMsg(sc *serverConn, ctx context.Context, msg *protocol.RPCMsg, call callFunc) error {
+	encodeRes, err := call(ctx, msg)
+	if err != nil {
+		return rl.sendError(sc, msg, err)
+	}
+
+	if err = rl.plugins.BeforeWriteHook(encodeRes); err != nil {
+		return rl.sendError(sc, msg, pluginError(err))
+	}
+	err = rl.sendData(sc, msg, encodeRes)
+	// 响应已写出，写入后插件的错误只记录
+	if hookErr := rl.plugins.AfterWriteHook(encodeRes, err); hookErr != nil {
+		log.Printf("写入后插件异常：%v\n", hookErr)
+	}
+	return err
+}
+
+// 处理单向调用，不写回响应，错误只记录
+func (rl *RPCListener) handleOneWay(ctx context.Context, msg *protocol.RPCMsg, call callFunc) {
+	if _, err := call(ctx, msg); err != nil {
+		log.Printf("单向调用 %s.%s 失败：%v\n", msg.ServiceClass, msg.ServiceMethod, err)
+	}
+}
+
+// 按并发限制调度 v1 请求，配置了工作池时交由工作池执行，读取协程等待执行结束
+func (rl *RPCListener) dispatch(ctx context.Context, msg *protocol.RPCMsg) ([]byte, error) {
+	release, err := rl.acquire(msg, rl.option.MaxQueueWait)
+	if err != nil {
+		log.Printf("拒绝请求 %s.%s：%v\n", msg.ServiceClass, msg.ServiceMethod, err)
+		return nil, err
+	}
+	defer release()
+
+	if rl.pool == nil {
+		return rl.process(ctx, msg)
+	}
+	var encodeRes []byte
+	if poolErr := rl.pool.execute(func() { encodeRes, err = rl.process(ctx, msg) }); poolErr != nil {
+		log.Printf("拒绝请求 %s.%s：%v\n", msg.ServiceClass, msg.ServiceMethod, poolErr)
+		return nil, poolErr
+	}
+	return encodeRes, err
+}
+
+// 获取请求的并发许可，最多等待 maxWait。先确认服务及方法存在，不存在的请求直接拒绝，
+// 避免客户端发送任意方法名使按方法的限制无限增长
+func (rl *RPCListener) acquire(msg *protocol.RPCMsg, maxWait time.Duration) (release func(), err error) {
+	handler, ok := rl.Handlers[msg.ServiceClass]
+	if !ok {
+		return nil, status.Errorf(status.NotFound, "服务 %s 不存在！", msg.ServiceClass)
+	}
+	known := false
+	if mh, ok := handler.(methodHandler); ok {
+		if !mh.HasMethod(msg.ServiceMethod) {
+			return nil, status.Errorf(status.NotFound, "方法 %s 不存在！", msg.ServiceMethod)
+		}
+		known = true
+	}
+	return rl.limits.acquire(msg.ServiceClass+"."+msg.ServiceMethod, known, maxWait)
+}
+
+// 解码参数、执行调用并编码结果
+func (rl *RPCListener) process(ctx context.Context, msg *protocol.RPCMsg) ([]byte, error) {
+	result, err := rl.invoke(ctx, msg, func(handler Handler) (UnaryHandler, error) {
+		return func(ctx context.Context, args []interface{}) ([]interface{}, error) {
+			return handler.Handle(ctx, msg.ServiceMethod, args)
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	encodeRes, err := global.Codecs[msg.Header.SerializeType()].Encode(result)
+	if err != nil {
+		return nil, status.Errorf(status.Internal, "结果编码失败：%v", err)
+	}
+	return encodeRes, nil
+}
+
+// 解码参数，经过插件及全局拦截器执行 call 返回的调用。
+// 处理中的 panic 只影响当前请求，转换为 Internal 错误返回，连接继续可用
+func (rl *RPCListener) invoke(ctx context.Context, msg *protocol.RPCMsg, call func(Handler) (UnaryHandler, error)) (result []interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			stack := debug.Stack()
+			log.Printf("调用 %s.%s 异常：%v\n%s", msg.ServiceClass, msg.ServiceMethod, r, stack)
+			rl.plugins.PanicHook(msg.ServiceClass, msg.ServiceMethod, r, stack)
+			// 调试模式下将堆栈返回给调用方，方便定位问题
+			if rl.option.Debug {
+				err = status.Errorf(status.Internal, "服务内部错误：%v\n%s", r, stack)
+			} else {
+				err = status.Errorf(status.Internal, "服务内部错误：%v", r)
+			}
+		}
+	}()
+
+	coder := global.Codecs[msg.Header.SerializeType()]
+	if coder == nil {
+		return nil, status.Errorf(status.InvalidArgument, "不支持的序列化类型：%d", msg.Header.SerializeType())
+	}
+	inArgs := make([]interface{}, 0)
+	err = coder.Decode(msg.Payload, &inArgs)
+	if err != nil {
+		return nil, status.Errorf(status.InvalidArgument, "参数解码失败：%v", err)
+	}
+	handler, ok := rl.Handlers[msg.ServiceClass]
+	if !ok {
+		return nil, status.Errorf(status.NotFound, "服务 %s 不存在！", msg.ServiceClass)
+	}
+	handle, err := call(handler)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = rl.plugins.BeforeCallHook(msg.ServiceClass, msg.ServiceMethod, inArgs); err != nil {
+		return nil, pluginError(err)
+	}
+	info := &MethodInfo{Class: msg.ServiceClass, Method: msg.ServiceMethod}
+	if msg.Metadata != nil {
+		ctx = metadata.NewIncomingContext(ctx, msg.Metadata)
+	}
+	result, err = chainInterceptors(rl.interceptors, info, handle)(ctx, inArgs)
+	if hookErr := rl.plugins.AfterCallHook(msg.ServiceClass, msg.ServiceMethod, inArgs, result, err); hookErr != nil {
+		return nil, pluginError(hookErr)
+	}
+	return result, err
+}
+
+// 处理流式请求。流可能长期存在，不占用工作池，只受并发数限制：
+// 获取许可后在独立协程中执行方法，被拒绝的流直接以错误帧结束
+func (rl *RPCListener) serveStream(sc *serverConn, ctx context.Context, msg *protocol.RPCMsg, hookErr error, stream *protocol.Stream) {
+	if hookErr != nil {
+		rl.endStream(sc, msg, stream, pluginError(hookErr))
+		return
+	}
+	rl.admit(sc, msg, func(release func(), err error) {
 		if err != nil {
+			log.Printf("拒绝请求 %s.%s：%v\n", msg.ServiceClass, msg.ServiceMethod, err)
+			rl.endStream(sc, msg, stream, err)
 			return
 		}
+		go rl.runStream(sc, ctx, msg, stream, release)
+	})
+}
+
+// 在独立协程中执行已获取许可的流式方法
+func (rl *RPCListener) runStream(sc *serverConn, ctx context.Context, msg *protocol.RPCMsg, stream *protocol.Stream, release func()) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Printf("服务 %s 异常r:%s\n", sc.RemoteAddr(), err)
+			sc.Close()
+		}
+	}()
+	atomic.AddInt32(&rl.handlingNum, 1)
+	defer atomic.AddInt32(&rl.handlingNum, -1)
+	defer release()
+
+	rl.endStream(sc, msg, stream, rl.processStream(ctx, msg, stream))
+}
+
+// 方法返回后以结束帧或错误帧结束流，写出失败时关闭连接
+func (rl *RPCListener) endStream(sc *serverConn, msg *protocol.RPCMsg, stream *protocol.Stream, err error) {
+	var writeErr error
+	if err != nil {
+		writeErr = stream.SendError(status.Convert(err).Marshal())
+	} else {
+		writeErr = stream.CloseSend()
+	}
+
+	stream.Close(protocol.ErrStreamClosed)
+	sc.removeStream(msg.RequestID)
+	msg.Release()
+	sc.end(msg, rl.isShutdown(), rl.sendGoAway)
+	if writeErr != nil {
+		sc.Close()
 	}
 }
 
-// 接收数据
-func (rl *RPCListener) receiveData(conn net.Conn) (*protocol.RPCMsg, error) {
-	msg, err := protocol.Read(conn)
+// 执行流式方法
+func (rl *RPCListener) processStream(ctx context.Context, msg *protocol.RPCMsg, stream *protocol.Stream) error {
+	ss := &serverStream{ctx: ctx, stream: stream, coder: global.Codecs[msg.Header.SerializeType()]}
+	_, err := rl.invoke(ctx, msg, func(handler Handler) (UnaryHandler, error) {
+		sh, ok := handler.(streamHandler)
+		if !ok || sh.StreamKind(msg.ServiceMethod) == Unary {
+			return nil, status.Errorf(status.Unimplemented, "方法 %s 不是流式方法！", msg.ServiceMethod)
+		}
+		return func(ctx context.Context, args []interface{}) ([]interface{}, error) {
+			return sh.handleStream(ctx, msg.ServiceMethod, args, ss)
+		}, nil
+	})
+	return err
+}
+
+// 插件返回的错误，未指定错误码时按调用中止处理
+func pluginError(err error) error {
+	var statusErr *status.Error
+	if errors.As(err, &statusErr) {
+		return statusErr
+	}
+	return status.New(status.Aborted, err.Error())
+}
+
+// 接收数据，超过长度限制或读取超时的连接计入违规并关闭
+func (rl *RPCListener) receiveData(conn net.Conn, reader *frameReader) (*protocol.RPCMsg, error) {
+	reader.reset()
+	msg, err := protocol.ReadWithLimits(reader, rl.frameLimits)
 	if err != nil {
 		if err != io.EOF {
+			rl.recordViolation(conn, reader, err)
 			return nil, err
 		}
 	}
 	return msg, nil
 }
 
-// 发送数据
-func (rl *RPCListener) sendData(conn net.Conn, payload []byte) error {
+// 统计并记录违规的连接
+func (rl *RPCListener) recordViolation(conn net.Conn, reader *frameReader, err error) {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, protocol.ErrFrameTooLarge):
+		atomic.AddInt64(&rl.violations.FrameTooLarge, 1)
+	case errors.Is(err, protocol.ErrNameTooLong):
+		atomic.AddInt64(&rl.violations.NameTooLong, 1)
+	case errors.Is(err, protocol.ErrBadMagic), errors.Is(err, protocol.ErrTruncated),
+		errors.Is(err, protocol.ErrMalformed), errors.Is(err, protocol.ErrUnsupportedVersion):
+		atomic.AddInt64(&rl.violations.Malformed, 1)
+	case errors.As(err, &netErr) && netErr.Timeout():
+		// 关闭流程中为中断空闲读取而设置的超时不计入违规
+		if rl.isShutdown() {
+			return
+		}
+		if reader.inHeader() {
+			atomic.AddInt64(&rl.violations.HeaderTimeout, 1)
+		} else {
+			atomic.AddInt64(&rl.violations.ReadTimeout, 1)
+		}
+	default:
+		return
+	}
+	log.Printf("连接 %s 违规，关闭连接：%v\n", conn.RemoteAddr(), err)
+}
+
+// Violations 获取连接违规计数
+func (rl *RPCListener) Violations() Violations {
+	return Violations{
+		FrameTooLarge: atomic.LoadInt64(&rl.violations.FrameTooLarge),
+		NameTooLong:   atomic.LoadInt64(&rl.violations.NameTooLong),
+		Malformed:     atomic.LoadInt64(&rl.violations.Malformed),
+		HeaderTimeout: atomic.LoadInt64(&rl.violations.HeaderTimeout),
+		ReadTimeout:   atomic.LoadInt64(&rl.violations.ReadTimeout),
+	}
+}
+
+// 按写超时发送消息，同一连接上的写入互斥。开启合并写时交给写协程
+func (rl *RPCListener) writeMsg(sc *serverConn, msg *protocol.RPCMsg) error {
+	if sc.writer != nil {
+		return sc.writer.Write(msg)
+	}
+
+	sc.writeMutex.Lock()
+	defer sc.writeMutex.Unlock()
+
+	if rl.option.WriteTimeout > 0 {
+		sc.SetWriteDeadline(time.Now().Add(rl.option.WriteTimeout))
+	}
+	return msg.Send(sc.Conn)
+}
+
+// 初始化响应消息，使用请求的协议版本及请求 ID
+func newReply(reqMsg *protocol.RPCMsg, msgType protocol.MsgType) *protocol.RPCMsg {
 	resMsg := protocol.NewRPCMsg()
-	resMsg.SetVersion(config.Protocol_MsgVersion)
-	resMsg.SetMsgType(protocol.Response)
+	resMsg.SetVersion(reqMsg.Version())
+	resMsg.SetMsgType(msgType)
 	resMsg.SetCompressType(protocol.None)
-	resMsg.SetSerializeType(protocol.Gob)
+	resMsg.SetSerializeType(reqMsg.SerializeType())
+	resMsg.RequestID = reqMsg.RequestID
+	return resMsg
+}
+
+// 发送数据
+func (rl *RPCListener) sendData(sc *serverConn, reqMsg *protocol.RPCMsg, payload []byte) error {
+	resMsg := newReply(reqMsg, protocol.Response)
 	resMsg.Payload = payload
-	return resMsg.Send(conn)
+	return rl.writeMsg(sc, resMsg)
+}
+
+// 发送错误响应，单向调用没有响应，错误只记录
+func (rl *RPCListener) sendError(sc *serverConn, reqMsg *protocol.RPCMsg, err error) error {
+	if reqMsg.Flags.Has(protocol.OneWay) {
+		log.Printf("单向调用 %s.%s 失败：%v\n", reqMsg.ServiceClass, reqMsg.ServiceMethod, err)
+		return nil
+	}
+	resMsg := newReply(reqMsg, protocol.Error)
+	resMsg.Payload = status.Convert(err).Marshal()
+	return rl.writeMsg(sc, resMsg)
+}
+
+// 发送 GoAway，通知客户端不要在该连接上继续发送请求
+func (rl *RPCListener) sendGoAway(sc *serverConn) error {
+	msg := protocol.NewRPCMsg()
+	msg.SetVersion(sc.version)
+	msg.SetMsgType(protocol.GoAway)
+	msg.SetCompressType(protocol.None)
+	msg.SetSerializeType(protocol.Gob)
+	return rl.writeMsg(sc, msg)
 }
 
 // GetAddrs 获取监听地址
 func (rl *RPCListener) GetAddrs() []string {
-	//l.nl.Addr()
-	addr := fmt.Sprintf("tcp://%s:%d", rl.ServiceIP, rl.ServicePort)
-	return []string{addr}
+	trans, err := rl.transport()
+	if err != nil {
+		return nil
+	}
+	addr := rl.listenAddr()
+	if rl.netListener != nil && trans.Scheme() == transport.SchemeTCP {
+		// 监听端口为 0 时由系统分配，返回实际监听的地址
+		addr = rl.netListener.Addr().String()
+	}
+	return []string{transport.FormatAddr(trans.Scheme(), rl.option.TLSConfig != nil, addr)}
 }
 
 func (rl *RPCListener) acceptConn() {
@@ -182,7 +798,20 @@ func (rl *RPCListener) acceptConn() {
 			}
 			return
 		}
-		go rl.handleConn(conn) //处理连接
+		// 接入插件可能包装连接，握手及读取对端证书需使用包装前的 TLS 连接
+		tlsConn, _ := conn.(*tls.Conn)
+		conn, ok := rl.plugins.ConnAcceptHook(conn)
+		if !ok {
+			// 插件拒绝连接，连接已由插件容器关闭
+			continue
+		}
+		sc := rl.trackConn(conn, tlsConn)
+		if sc == nil {
+			log.Printf("超过最大连接数 %d，拒绝连接 %s\n", rl.option.MaxConns, conn.RemoteAddr())
+			rl.CloseConn(conn)
+			continue
+		}
+		go rl.handleConn(sc) //处理连接
 	}
 }
 
@@ -204,13 +833,54 @@ func (rl *RPCListener) isShutdown() bool {
 	return atomic.LoadInt32(&rl.shutdown) == 1
 }
 
-// Shutdown 关闭逻辑
-func (rl *RPCListener) Shutdown() {
-	atomic.CompareAndSwapInt32(&rl.shutdown, 0, 1)
+// Shutdown 优雅关闭：停止接收新连接，向所有连接发送 GoAway，等待处理中的请求完成。
+// ctx 结束时强制关闭剩余连接，返回被中断的连接和请求数
+func (rl *RPCListener) Shutdown(ctx context.Context) error {
+	if !atomic.CompareAndSwapInt32(&rl.shutdown, 0, 1) {
+		return errors.New("服务已关闭！")
+	}
+	rl.closeDoneChan()
+	if rl.netListener != nil {
+		rl.netListener.Close()
+	}
+
+	rl.connMutex.Lock()
+	for _, sc := range rl.conns {
+		sc.drain(rl.sendGoAway)
+	}
+	rl.connMutex.Unlock()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
 	for {
-		if atomic.LoadInt32(&rl.handlingNum) == 0 {
+		rl.connMutex.Lock()
+		remaining := len(rl.conns)
+		rl.connMutex.Unlock()
+		if remaining == 0 {
 			break
 		}
+
+		select {
+		case <-ticker.C:
+			continue
+		case <-ctx.Done():
+		}
+
+		// 超过等待时间，强制关闭剩余连接
+		aborted := atomic.LoadInt32(&rl.handlingNum)
+		rl.connMutex.Lock()
+		for conn := range rl.conns {
+			conn.Close()
+		}
+		rl.connMutex.Unlock()
+		if rl.pool != nil {
+			go rl.pool.stop()
+		}
+		return fmt.Errorf("优雅关闭超时，强制关闭 %d 个连接，中断 %d 个处理中的请求：%w", remaining, aborted, ctx.Err())
 	}
-	rl.closeDoneChan()
+
+	if rl.pool != nil {
+		rl.pool.stop()
+	}
+	return nil
 }
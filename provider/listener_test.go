@@ -0,0 +1,359 @@
+package provider_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zhangweijie11/zRPC/consumer"
+	"github.com/zhangweijie11/zRPC/global"
+	"github.com/zhangweijie11/zRPC/naming"
+	"github.com/zhangweijie11/zRPC/protocol"
+	"github.com/zhangweijie11/zRPC/provider"
+	"github.com/zhangweijie11/zRPC/status"
+	"github.com/zhangweijie11/zRPC/transport"
+	"github.com/zhangweijie11/zRPC/zrpctest"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+type Slow struct {
+	started chan struct{}
+	unblock chan struct{}
+}
+
+func (s *Slow) Wait(ctx context.Context) (int, error) {
+	s.started <- struct{}{}
+	<-s.unblock
+	return 1, nil
+}
+
+// 并发许可不足时只有连接等待队列中的请求占用协程，超出队列的请求直接被拒绝
+func TestServeAsyncBoundsGoroutines(t *testing.T) {
+	const calls, pending = 50, 4
+	slow := &Slow{started: make(chan struct{}, calls), unblock: make(chan struct{})}
+	option := provider.DefaultOption
+	option.MaxConcurrentRequests = 1
+	option.MaxQueueWait = 5 * time.Second
+	option.MaxPendingRequests = pending
+	srv := zrpctest.NewServer(zrpctest.Config{Option: option}, func(rs *provider.RPCServer) {
+		rs.Register(slow)
+	})
+	defer srv.Close()
+
+	clientOption := consumer.DefaultOption
+	clientOption.ReadTimeout = 10 * time.Second
+	cli, err := srv.NewClient(clientOption)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+	svc := &consumer.Service{Class: "Slow", Method: "Wait"}
+
+	// 先占用唯一的许可
+	go cli.Call(context.Background(), svc, nil)
+	<-slow.started
+
+	before := runtime.NumGoroutine()
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	rejected := 0
+	for i := 0; i < calls; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := cli.Call(context.Background(), svc, nil)
+			if status.CodeOf(err) == status.ResourceExhausted {
+				mutex.Lock()
+				rejected++
+				mutex.Unlock()
+			} else if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mutex.Lock()
+		n := rejected
+		mutex.Unlock()
+		if n == calls-pending {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d calls rejected, want %d", n, calls-pending)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// 剩余调用方的协程之外，服务端只为等待队列中的请求各占用一个协程
+	if grown := runtime.NumGoroutine() - before - pending; grown > pending+5 {
+		t.Errorf("goroutines grew by %d beyond the %d waiting callers", grown, pending)
+	}
+
+	close(slow.unblock)
+	wg.Wait()
+}
+
+type Blocker struct {
+	started  chan struct{}
+	canceled chan struct{}
+}
+
+func (b *Blocker) Block(ctx context.Context) (int, error) {
+	b.started <- struct{}{}
+	<-ctx.Done()
+	b.canceled <- struct{}{}
+	return 0, ctx.Err()
+}
+
+// 请求等待许可时读取协程仍在读取，处理中请求的取消帧能及时送达
+func TestCancelWhileLimitSaturated(t *testing.T) {
+	blocker := &Blocker{started: make(chan struct{}, 2), canceled: make(chan struct{}, 2)}
+	option := provider.DefaultOption
+	option.MaxConcurrentRequests = 1
+	option.MaxQueueWait = 5 * time.Second
+	srv := zrpctest.NewServer(zrpctest.Config{Option: option}, func(rs *provider.RPCServer) {
+		rs.Register(blocker)
+	})
+	defer srv.Close()
+
+	clientOption := consumer.DefaultOption
+	clientOption.ReadTimeout = 10 * time.Second
+	cli, err := srv.NewClient(clientOption)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+	svc := &consumer.Service{Class: "Blocker", Method: "Block"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := cli.Call(ctx, svc, nil)
+		first <- err
+	}()
+	<-blocker.started
+
+	// 第二个请求等待唯一的许可
+	waitCtx, waitCancel := context.WithCancel(context.Background())
+	defer waitCancel()
+	go cli.Call(waitCtx, svc, nil)
+	time.Sleep(50 * time.Millisecond)
+
+	cancel()
+	if err := <-first; err != context.Canceled {
+		t.Fatalf("first call: got %v, want context.Canceled", err)
+	}
+	select {
+	case <-blocker.canceled:
+	case <-time.After(time.Second):
+		t.Fatal("Cancel frame not processed while another request waits for a permit")
+	}
+	// 许可归还后等待中的请求开始处理
+	select {
+	case <-blocker.started:
+	case <-time.After(time.Second):
+		t.Fatal("waiting request not admitted after the permit was released")
+	}
+	waitCancel()
+}
+
+// 在本地回环地址的随机端口上启动服务，返回直连该服务的客户端
+func startHello(b *testing.B, option provider.Option, clientOption consumer.Option) *consumer.RPCClient {
+	option.Ip, option.Port, option.AppID = "127.0.0.1", 0, "bench"
+	registry := naming.NewMemoryRegistry()
+	server := provider.NewRPCServer(option, registry)
+	server.RegisterName("Hello", &global.HelloHandler{})
+	server.Run()
+	b.Cleanup(server.Close)
+
+	instances, _ := registry.Fetch(context.Background(), "bench")
+	client := consumer.NewClient(clientOption)
+	if err := client.Connect(instances[0].Addresses[0]); err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(client.Close)
+	return client
+}
+
+// 经过本地回环网络的完整调用，包含参数的序列化
+func benchmarkRoundTrip(b *testing.B, version byte) {
+	clientOption := consumer.DefaultOption
+	clientOption.ProtocolVersion = version
+	client := startHello(b, provider.DefaultOption, clientOption)
+	service := &consumer.Service{Class: "Hello", Method: "Hello"}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := client.Call(context.Background(), service, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// 单个连接上 1000 个并发的小调用，对比是否开启合并写
+func benchmarkConcurrent(b *testing.B, batch bool) {
+	option := provider.DefaultOption
+	option.WriteBatch = batch
+	clientOption := consumer.DefaultOption
+	clientOption.WriteBatch = batch
+	client := startHello(b, option, clientOption)
+	service := &consumer.Service{Class: "Hello", Method: "Hello"}
+
+	b.ReportAllocs()
+	b.SetParallelism((1000 + runtime.GOMAXPROCS(0) - 1) / runtime.GOMAXPROCS(0))
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := client.Call(context.Background(), service, nil); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkRoundTripV1(b *testing.B)     { benchmarkRoundTrip(b, protocol.Version1) }
+func BenchmarkRoundTripV2(b *testing.B)     { benchmarkRoundTrip(b, protocol.Version2) }
+func BenchmarkConcurrent(b *testing.B)      { benchmarkConcurrent(b, false) }
+func BenchmarkConcurrentBatch(b *testing.B) { benchmarkConcurrent(b, true) }
+
+type Panicker struct{}
+
+func (p *Panicker) Boom(ctx context.Context) (int, error) {
+	panic("boom")
+}
+
+func (p *Panicker) Ok(ctx context.Context) (int, error) {
+	return 1, nil
+}
+
+// 记录 PanicHook 的参数
+type panicRecorder struct {
+	mutex  sync.Mutex
+	method string
+	value  interface{}
+	stack  []byte
+}
+
+func (pr *panicRecorder) HandlePanic(class, method string, recovered interface{}, stack []byte) {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+	pr.method, pr.value, pr.stack = class+"."+method, recovered, stack
+}
+
+// 处理方法 panic 时返回 Internal 错误并通知插件，同一连接上的其他请求不受影响
+func TestPanicRecovery(t *testing.T) {
+	for _, version := range []byte{protocol.Version1, protocol.Version2} {
+		t.Run(fmt.Sprintf("v%d", version), func(t *testing.T) {
+			recorder := &panicRecorder{}
+			srv := zrpctest.NewServer(zrpctest.Config{}, func(rs *provider.RPCServer) {
+				rs.AddPlugin(recorder)
+				rs.Register(&Panicker{})
+			})
+			defer srv.Close()
+
+			option := consumer.DefaultOption
+			option.ProtocolVersion = version
+			cli, err := srv.NewClient(option)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cli.Close()
+
+			_, err = cli.Call(context.Background(), &consumer.Service{Class: "Panicker", Method: "Boom"}, nil)
+			if status.CodeOf(err) != status.Internal {
+				t.Fatalf("Boom: got %v, want Internal", err)
+			}
+			recorder.mutex.Lock()
+			method, value, stack := recorder.method, recorder.value, string(recorder.stack)
+			recorder.mutex.Unlock()
+			if method != "Panicker.Boom" || value != "boom" || !strings.Contains(stack, "Panicker).Boom") {
+				t.Fatalf("PanicHook got %q, %v, stack:\n%s", method, value, stack)
+			}
+
+			res, err := cli.Call(context.Background(), &consumer.Service{Class: "Panicker", Method: "Ok"}, nil)
+			if err != nil {
+				t.Fatalf("call after panic on the same connection: %v", err)
+			}
+			if len(res) == 0 || fmt.Sprint(res[0]) != "1" {
+				t.Fatalf("Ok = %v, want 1", res)
+			}
+		})
+	}
+}
+
+// 直接连接测试服务，发送原始字节
+func dialRaw(t *testing.T, srv *zrpctest.Server) net.Conn {
+	scheme, _, addr, _ := transport.ParseAddr(srv.Addr)
+	trans, err := transport.Get(scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := trans.Dial(addr, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// 等待服务端关闭连接，超时返回 false
+func closedByServer(conn net.Conn, timeout time.Duration) bool {
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	_, err := io.ReadAll(conn)
+	return err == nil
+}
+
+// 违规的连接被关闭并计数
+func TestViolations(t *testing.T) {
+	// 0x06 为协议头的魔术数
+	header := []byte{0x06, protocol.Version1, byte(protocol.Request), 0, byte(protocol.Gob)}
+	tests := []struct {
+		name  string
+		frame []byte
+		count func(provider.Violations) int64
+	}{
+		{
+			name:  "oversized length prefix",
+			frame: append(append([]byte{}, header...), 0xFF, 0xFF, 0xFF, 0xFF),
+			count: func(v provider.Violations) int64 { return v.FrameTooLarge },
+		},
+		{
+			name:  "stalled header",
+			frame: header[:3],
+			count: func(v provider.Violations) int64 { return v.HeaderTimeout },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			option := provider.DefaultOption
+			option.HeaderTimeout = 100 * time.Millisecond
+			srv := zrpctest.NewServer(zrpctest.Config{Option: option}, nil)
+			defer srv.Close()
+
+			conn := dialRaw(t, srv)
+			if _, err := conn.Write(tt.frame); err != nil {
+				t.Fatal(err)
+			}
+			if !closedByServer(conn, 2*time.Second) {
+				t.Fatal("connection not closed by the server")
+			}
+			if n := tt.count(srv.Violations()); n != 1 {
+				t.Fatalf("violation count = %d, want 1 (%+v)", n, srv.Violations())
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package provider
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+)
+
+// Peer 客户端连接的对端信息
+type Peer struct {
+	Addr net.Addr
+	TLS  *tls.ConnectionState // 未使用 TLS 时为 nil
+	// Certificate 已通过校验的客户端证书，未开启双向认证或客户端未提供证书时为 nil
+	Certificate *x509.Certificate
+	// Identity 客户端证书的身份，依次取第一个 URI、DNS 名、邮箱 SAN，都没有时取 CN
+	Identity string
+}
+
+type peerKey struct{}
+
+// PeerFromContext 获取发起请求的客户端连接的对端信息
+func PeerFromContext(ctx context.Context) (*Peer, bool) {
+	peer, ok := ctx.Value(peerKey{}).(*Peer)
+	return peer, ok
+}
+
+// 生成连接的对端信息，tlsConn 为连接底层的 TLS 连接，需已完成握手
+func newPeer(conn net.Conn, tlsConn *tls.Conn) *Peer {
+	peer := &Peer{Addr: conn.RemoteAddr()}
+	if tlsConn == nil {
+		return peer
+	}
+	state := tlsConn.ConnectionState()
+	peer.TLS = &state
+	if len(state.VerifiedChains) > 0 && len(state.VerifiedChains[0]) > 0 {
+		peer.Certificate = state.VerifiedChains[0][0]
+		peer.Identity = certIdentity(peer.Certificate)
+	}
+	return peer
+}
+
+func certIdentity(cert *x509.Certificate) string {
+	switch {
+	case len(cert.URIs) > 0:
+		return cert.URIs[0].String()
+	case len(cert.DNSNames) > 0:
+		return cert.DNSNames[0]
+	case len(cert.EmailAddresses) > 0:
+		return cert.EmailAddresses[0]
+	default:
+		return cert.Subject.CommonName
+	}
+}
@@ -15,13 +15,15 @@ type PluginContainer interface {
 	RegisterHook(string, interface{}) error
 	UnregisterHook(string) error
 	ConnAcceptHook(net.Conn) (net.Conn, bool)
-	//ConnCloseHook() error
+	ConnCloseHook(net.Conn) error
+	PeerHook(*Peer) error
 	BeforeReadHook() error
 	AfterReadHook(*protocol.RPCMsg, error) error
 	BeforeCallHook(string, string, []interface{}) error
 	AfterCallHook(string, string, []interface{}, []interface{}, error) error
 	BeforeWriteHook([]byte) error
 	AfterWriteHook([]byte, error) error
+	PanicHook(string, string, interface{}, []byte)
 }
 
 type Plugin interface{}
@@ -35,6 +37,15 @@ type ConnAcceptPlugin interface {
 	HandleConnAccept(net.Conn) (net.Conn, bool)
 }
 
+type ConnClosePlugin interface {
+	HandleConnClose(net.Conn) error
+}
+
+// PeerPlugin 连接建立（TLS 连接完成握手）后、读取请求前通知对端信息，返回错误时关闭连接，可用于按证书身份准入
+type PeerPlugin interface {
+	HandlePeer(*Peer) error
+}
+
 type BeforeReadPlugin interface {
 	BeforeRead() error
 }
@@ -59,10 +70,20 @@ type AfterWritePlugin interface {
 	AfterWrite([]byte, error) error
 }
 
+// PanicPlugin 调用 panic 时通知，参数依次为服务名、方法名、panic 值和堆栈
+type PanicPlugin interface {
+	HandlePanic(string, string, interface{}, []byte)
+}
+
 type pluginContainer struct {
 	plugins []Plugin
 }
 
+// NewPluginContainer 初始化插件容器
+func NewPluginContainer() PluginContainer {
+	return &pluginContainer{}
+}
+
 func (p *pluginContainer) Add(plugin Plugin) {
 	if plugin == nil {
 		return
@@ -133,6 +154,33 @@ func (p *pluginContainer) ConnAcceptHook(conn net.Conn) (net.Conn, bool) {
 	return conn, true
 }
 
+func (p *pluginContainer) ConnCloseHook(conn net.Conn) error {
+	var errs string
+	for _, v := range p.plugins {
+		if connClosePlugin, ok := v.(ConnClosePlugin); ok {
+			err := connClosePlugin.HandleConnClose(conn)
+			if err != nil {
+				errs = fmt.Sprintf("%v\r%v", errs, err)
+			}
+		}
+	}
+	if len(errs) > 0 && errs != "" {
+		return errors.New(errs)
+	}
+	return nil
+}
+
+func (p *pluginContainer) PeerHook(peer *Peer) error {
+	for _, v := range p.plugins {
+		if plugin, ok := v.(PeerPlugin); ok {
+			if err := plugin.HandlePeer(peer); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func (p *pluginContainer) BeforeReadHook() error {
 	for _, v := range p.plugins {
 		if plugin, ok := v.(BeforeReadPlugin); ok {
@@ -203,3 +251,11 @@ func (p *pluginContainer) AfterWriteHook(res []byte, err error) error {
 	}
 	return nil
 }
+
+func (p *pluginContainer) PanicHook(class string, method string, recovered interface{}, stack []byte) {
+	for _, v := range p.plugins {
+		if plugin, ok := v.(PanicPlugin); ok {
+			plugin.HandlePanic(class, method, recovered, stack)
+		}
+	}
+}
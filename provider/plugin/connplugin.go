@@ -11,3 +11,8 @@ func (plugin ConnPlugin) HandleConnAccept(conn net.Conn) (net.Conn, bool) {
 	fmt.Println("==== conn accept plugin ====", conn)
 	return conn, true
 }
+
+func (plugin ConnPlugin) HandleConnClose(conn net.Conn) error {
+	fmt.Println("==== conn close plugin ====", conn)
+	return nil
+}
@@ -0,0 +1,9 @@
+package plugin
+
+import "fmt"
+
+type PanicPlugin struct{}
+
+func (p PanicPlugin) HandlePanic(class string, method string, recovered interface{}, stack []byte) {
+	fmt.Println("==== panic plugin ====", class, method, recovered)
+}
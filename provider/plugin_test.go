@@ -0,0 +1,98 @@
+package provider_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zhangweijie11/zRPC/consumer"
+	"github.com/zhangweijie11/zRPC/provider"
+	"github.com/zhangweijie11/zRPC/zrpctest"
+)
+
+// 记录连接相关插件的调用
+type connRecorder struct {
+	mutex  sync.Mutex
+	peers  int
+	closed map[net.Conn]int
+}
+
+func (cr *connRecorder) HandlePeer(peer *provider.Peer) error {
+	cr.mutex.Lock()
+	defer cr.mutex.Unlock()
+	cr.peers++
+	return nil
+}
+
+func (cr *connRecorder) HandleConnClose(conn net.Conn) error {
+	cr.mutex.Lock()
+	defer cr.mutex.Unlock()
+	cr.closed[conn]++
+	return nil
+}
+
+// 已关闭的连接数及每个连接的关闭通知次数
+func (cr *connRecorder) closes() (int, []int) {
+	cr.mutex.Lock()
+	defer cr.mutex.Unlock()
+	var counts []int
+	for _, n := range cr.closed {
+		counts = append(counts, n)
+	}
+	return len(cr.closed), counts
+}
+
+// 每个连接建立时通知对端信息，关闭时无论由哪一端关闭都只通知一次
+func TestConnHooks(t *testing.T) {
+	recorder := &connRecorder{closed: make(map[net.Conn]int)}
+	srv := zrpctest.NewServer(zrpctest.Config{}, func(rs *provider.RPCServer) {
+		rs.AddPlugin(recorder)
+		rs.Register(&Panicker{})
+	})
+	defer srv.Close()
+
+	const conns = 3
+	var clients []*consumer.RPCClient
+	for i := 0; i < conns; i++ {
+		cli, err := srv.NewClient(consumer.DefaultOption)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = cli.Call(context.Background(), &consumer.Service{Class: "Panicker", Method: "Ok"}, nil); err != nil {
+			t.Fatal(err)
+		}
+		clients = append(clients, cli)
+	}
+	recorder.mutex.Lock()
+	peers := recorder.peers
+	recorder.mutex.Unlock()
+	if peers != conns {
+		t.Fatalf("PeerHook fired %d times, want %d", peers, conns)
+	}
+
+	// 前两个连接由客户端关闭，最后一个由服务端断开
+	clients[0].Close()
+	clients[1].Close()
+	srv.DropConnections()
+	defer clients[2].Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if n, _ := recorder.closes(); n == conns || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	n, counts := recorder.closes()
+	if n != conns {
+		t.Fatalf("ConnCloseHook fired for %d connections, want %d", n, conns)
+	}
+	for _, count := range counts {
+		if count != 1 {
+			t.Fatalf("ConnCloseHook fired %v times per connection, want once each", counts)
+		}
+	}
+}
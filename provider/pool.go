@@ -0,0 +1,192 @@
+package provider
+
+import (
+	"github.com/zhangweijie11/zRPC/status"
+	"sync"
+	"time"
+)
+
+// workerPool 固定数量的工作协程执行请求，请求先进入有界队列，
+// 队列已满或排队超过最大等待时间的请求被拒绝
+type workerPool struct {
+	tasks   chan *task
+	maxWait time.Duration
+	wg      sync.WaitGroup
+	mutex   sync.RWMutex
+	stopped bool
+}
+
+type task struct {
+	run      func()
+	reject   func(error)
+	enqueued time.Time
+}
+
+func newWorkerPool(workers int, queueSize int, maxWait time.Duration) *workerPool {
+	pool := &workerPool{tasks: make(chan *task, queueSize), maxWait: maxWait}
+	pool.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go pool.work()
+	}
+	return pool
+}
+
+func (p *workerPool) work() {
+	defer p.wg.Done()
+	for t := range p.tasks {
+		if p.maxWait > 0 && time.Since(t.enqueued) > p.maxWait {
+			t.reject(status.New(status.ResourceExhausted, "请求排队超时！"))
+			continue
+		}
+		t.run()
+	}
+}
+
+// 提交请求，等待执行结束后返回。请求被拒绝时返回 ResourceExhausted 错误
+func (p *workerPool) execute(run func()) error {
+	done := make(chan error, 1)
+	err := p.submit(func() {
+		run()
+		done <- nil
+	}, func(err error) { done <- err })
+	if err != nil {
+		return err
+	}
+	return <-done
+}
+
+// 提交请求后立即返回，队列已满时返回 ResourceExhausted 错误；
+// 入队后排队超时的请求由工作协程调用 reject 拒绝
+func (p *workerPool) submit(run func(), reject func(error)) error {
+	t := &task{run: run, reject: reject, enqueued: time.Now()}
+
+	p.mutex.RLock()
+	if p.stopped {
+		p.mutex.RUnlock()
+		return status.New(status.Unavailable, "服务已关闭！")
+	}
+	select {
+	case p.tasks <- t:
+	default:
+		p.mutex.RUnlock()
+		return status.New(status.ResourceExhausted, "请求队列已满！")
+	}
+	p.mutex.RUnlock()
+	return nil
+}
+
+// 停止工作协程，等待已入队的请求处理完成
+func (p *workerPool) stop() {
+	p.mutex.Lock()
+	if p.stopped {
+		p.mutex.Unlock()
+		return
+	}
+	p.stopped = true
+	close(p.tasks)
+	p.mutex.Unlock()
+
+	p.wg.Wait()
+}
+
+// 每个连接上等待并发许可的默认最大请求数
+const defaultMaxPendingRequests = 64
+
+// limiter 并发数限制
+type limiter struct {
+	tokens chan struct{}
+}
+
+func newLimiter(limit int) *limiter {
+	return &limiter{tokens: make(chan struct{}, limit)}
+}
+
+// 获取许可，最多等待 maxWait，超时返回 false
+func (l *limiter) acquire(maxWait time.Duration) bool {
+	select {
+	case l.tokens <- struct{}{}:
+		return true
+	default:
+	}
+	if maxWait <= 0 {
+		return false
+	}
+
+	timer := time.NewTimer(maxWait)
+	defer timer.Stop()
+	select {
+	case l.tokens <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+func (l *limiter) release() {
+	<-l.tokens
+}
+
+// concurrencyLimits 全局及按方法的并发请求数限制
+type concurrencyLimits struct {
+	option  Option
+	global  *limiter
+	mutex   sync.Mutex
+	methods map[string]*limiter
+}
+
+func newConcurrencyLimits(option Option) *concurrencyLimits {
+	limits := &concurrencyLimits{option: option, methods: make(map[string]*limiter)}
+	if option.MaxConcurrentRequests > 0 {
+		limits.global = newLimiter(option.MaxConcurrentRequests)
+	}
+	return limits
+}
+
+// 获取方法对应的限制，未配置限制时返回 nil。
+// known 表示方法已确认存在，未确认的方法只受 MethodConcurrency 中配置的限制，保证限制的数量有界
+func (c *concurrencyLimits) methodLimiter(method string, known bool) *limiter {
+	limit, ok := c.option.MethodConcurrency[method]
+	if !ok {
+		if !known {
+			return nil
+		}
+		limit = c.option.MaxMethodConcurrency
+	}
+	if limit <= 0 {
+		return nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	l, ok := c.methods[method]
+	if !ok {
+		l = newLimiter(limit)
+		c.methods[method] = l
+	}
+	return l
+}
+
+// 获取全局及方法的并发许可，最多等待 maxWait，超过限制时返回 ResourceExhausted 错误，
+// 成功时返回的 release 用于归还许可
+func (c *concurrencyLimits) acquire(method string, known bool, maxWait time.Duration) (release func(), err error) {
+	if c.global != nil && !c.global.acquire(maxWait) {
+		return nil, status.New(status.ResourceExhausted, "超过最大并发请求数！")
+	}
+
+	methodLimiter := c.methodLimiter(method, known)
+	if methodLimiter != nil && !methodLimiter.acquire(maxWait) {
+		if c.global != nil {
+			c.global.release()
+		}
+		return nil, status.Errorf(status.ResourceExhausted, "超过方法 %s 的最大并发请求数！", method)
+	}
+
+	return func() {
+		if methodLimiter != nil {
+			methodLimiter.release()
+		}
+		if c.global != nil {
+			c.global.release()
+		}
+	}, nil
+}
@@ -0,0 +1,58 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/zhangweijie11/zRPC/protocol"
+	"github.com/zhangweijie11/zRPC/status"
+)
+
+type Echo struct{}
+
+func (Echo) Say(ctx context.Context, s string) (string, error) {
+	return s, nil
+}
+
+// 不存在的服务或方法在获取许可前被拒绝，不会为其创建按方法的限制
+func TestAcquireUnknownMethod(t *testing.T) {
+	option := DefaultOption
+	option.MaxMethodConcurrency = 1
+	rl := NewRPCListener(option)
+	handler, err := newRPCServerHandler("Echo", Echo{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rl.SetHandler("Echo", handler)
+
+	for i := 0; i < 100; i++ {
+		msg := protocol.NewRPCMsg()
+		msg.ServiceClass = "Echo"
+		msg.ServiceMethod = fmt.Sprintf("Method%d", i)
+		if _, err := rl.acquire(msg, 0); status.CodeOf(err) != status.NotFound {
+			t.Fatalf("acquire unknown method: got %v, want NotFound", err)
+		}
+		msg.ServiceClass = fmt.Sprintf("Class%d", i)
+		if _, err := rl.acquire(msg, 0); status.CodeOf(err) != status.NotFound {
+			t.Fatalf("acquire unknown class: got %v, want NotFound", err)
+		}
+	}
+	if n := len(rl.limits.methods); n != 0 {
+		t.Fatalf("unknown methods created %d limiters", n)
+	}
+
+	msg := protocol.NewRPCMsg()
+	msg.ServiceClass, msg.ServiceMethod = "Echo", "Say"
+	release, err := rl.acquire(msg, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rl.acquire(msg, 0); status.CodeOf(err) != status.ResourceExhausted {
+		t.Fatalf("second acquire: got %v, want ResourceExhausted", err)
+	}
+	release()
+	if n := len(rl.limits.methods); n != 1 {
+		t.Fatalf("got %d limiters, want 1", n)
+	}
+}
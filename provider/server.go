@@ -2,8 +2,10 @@ package provider
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"github.com/zhangweijie11/zRPC/naming"
+	"github.com/zhangweijie11/zRPC/transport"
 	"log"
 	"reflect"
 	"time"
@@ -16,7 +18,7 @@ type Server interface {
 	Register(string, interface{})
 	Run()
 	Close()
-	Shutdown()
+	Shutdown(context.Context) error
 }
 
 type Option struct {
@@ -25,15 +27,39 @@ type Option struct {
 	Hostname     string
 	AppID        string
 	Env          string
-	NetProtocol  string
-	ReadTimeout  time.Duration
-	WriteTimeout time.Duration
+	NetProtocol  string              // 传输协议，Transport 为空时按该前缀选择内置的传输方式，默认为 tcp
+	Transport    transport.Transport // 传输方式，为空时按 NetProtocol 选择
+	Address      string              // 监听地址，不为空时代替 Ip:Port，如 Unix 套接字路径或内存地址名
+	ReadTimeout  time.Duration       // 帧头读完后，消息体需在该时间内读完
+	WriteTimeout time.Duration       // 每条消息的写超时
+	Debug        bool                // 调试模式，调用 panic 时将堆栈返回给调用方
+	TLSConfig    *tls.Config         // TLS 配置，为空时使用明文连接；双向认证需设置 ClientAuth 及 ClientCAs
+
+	ProtocolVersion byte          // 支持的最高协议版本，0 表示 protocol.MaxVersion
+	WriteBatch      bool          // 开启合并写，同一连接上并发请求的响应由写协程合并后写出
+	WriteBatchDelay time.Duration // 合并写时队列排空后继续等待更多帧的最长时间，0 表示立即写出
+	WriteBufferSize int           // 合并写的缓冲区大小，0 表示使用默认值
+	StreamWindow    int           // 流式调用的接收窗口，即每个流最多缓冲的数据帧数，0 表示使用默认值
+
+	HeaderTimeout time.Duration // 收到帧首字节后，帧头需在该时间内读完，防止慢速攻击
+	MaxFrameSize  int           // 消息体最大长度，0 表示使用默认值
+	MaxNameLen    int           // 服务名、方法名最大长度，0 表示使用默认值
+
+	MaxConns              int            // 最大连接数，0 表示不限制
+	MaxConcurrentRequests int            // 全局最大并发请求数，0 表示不限制
+	MaxMethodConcurrency  int            // 每个方法的最大并发请求数，0 表示不限制
+	MethodConcurrency     map[string]int // 按方法（Class.Method）覆盖的最大并发请求数
+	Workers               int            // 工作池协程数，0 表示不使用工作池
+	QueueSize             int            // 工作池排队队列长度，0 表示不排队
+	MaxQueueWait          time.Duration  // 请求等待并发许可或排队的最长时间，超时返回 ResourceExhausted
+	MaxPendingRequests    int            // 每个 v2 连接上等待并发许可的最大请求数，超过时直接拒绝，0 表示使用默认值
 }
 
 var DefaultOption = Option{
-	NetProtocol:  "tcp",
-	ReadTimeout:  5 * time.Second,
-	WriteTimeout: 5 * time.Second,
+	NetProtocol:   "tcp",
+	ReadTimeout:   5 * time.Second,
+	WriteTimeout:  5 * time.Second,
+	HeaderTimeout: 5 * time.Second,
 }
 
 type RPCServer struct {
@@ -41,11 +67,21 @@ type RPCServer struct {
 	registry   naming.Registry
 	option     Option
 	cancelFunc context.CancelFunc
+	plugins    PluginContainer
+	services   []string // 已注册的服务名
 }
 
 // NewRPCServer 初始化 RPC 服务
 func NewRPCServer(option Option, registry naming.Registry) *RPCServer {
-	return &RPCServer{listener: NewRPCListener(option), registry: registry, option: option}
+	plugins := NewPluginContainer()
+	listener := NewRPCListener(option)
+	listener.SetPlugins(plugins)
+	return &RPCServer{listener: listener, registry: registry, option: option, plugins: plugins}
+}
+
+// AddPlugin 添加插件，插件实现的各个 Plugin 接口会在对应时机被调用，需在注册服务和启动前添加
+func (rs *RPCServer) AddPlugin(plugin Plugin) {
+	rs.plugins.Add(plugin)
 }
 
 // Run 启动服务
@@ -88,6 +124,7 @@ func (rs *RPCServer) Close() {
 	if rs.cancelFunc != nil {
 		rs.cancelFunc()
 	}
+	rs.unregisterServices()
 
 	// 关闭当前服务
 	if rs.listener != nil {
@@ -95,32 +132,64 @@ func (rs *RPCServer) Close() {
 	}
 }
 
+// Use 注册作用于所有服务的拦截器，按注册顺序依次执行，需在启动前注册
+func (rs *RPCServer) Use(interceptors ...Interceptor) {
+	rs.listener.Use(interceptors...)
+}
+
 // Register 注册服务
-func (rs *RPCServer) Register(class interface{}) {
+func (rs *RPCServer) Register(class interface{}, interceptors ...Interceptor) error {
 	name := reflect.Indirect(reflect.ValueOf(class)).Type().Name()
-	rs.RegisterName(name, class)
-
+	return rs.RegisterName(name, class, interceptors...)
 }
 
-// RegisterName 通过名字注册服务
-func (rs *RPCServer) RegisterName(name string, class interface{}) {
-	handler := &RPCServerHandler{
-		rpcServer: nil,
-		class:     reflect.ValueOf(class),
+// RegisterName 通过名字注册服务，interceptors 仅作用于该服务，在全局拦截器之后执行。
+// 流式方法的签名不合法或注册插件返回错误时拒绝注册
+func (rs *RPCServer) RegisterName(name string, class interface{}, interceptors ...Interceptor) error {
+	handler, err := newRPCServerHandler(name, class, interceptors)
+	if err != nil {
+		log.Printf("%s 注册失败：%v", name, err)
+		return err
 	}
+	if err = rs.plugins.RegisterHook(name, class); err != nil {
+		log.Printf("%s 注册失败：%v", name, err)
+		return err
+	}
+
 	rs.listener.SetHandler(name, handler)
+	rs.services = append(rs.services, name)
 	log.Printf("%s 注册成功！", name)
+	return nil
 }
 
-// Shutdown 注销服务
-func (rs *RPCServer) Shutdown() {
+// 通知注册插件注销所有服务
+func (rs *RPCServer) unregisterServices() {
+	for _, name := range rs.services {
+		if err := rs.plugins.UnregisterHook(name); err != nil {
+			log.Printf("%s 注销插件异常：%v", name, err)
+		}
+	}
+	rs.services = nil
+}
+
+// Shutdown 优雅关闭：先从服务注册中心注销，避免新的客户端发现本服务，再停止接收新连接、
+// 通知已连接的客户端不再发送请求，并等待处理中的请求完成。ctx 结束时强制关闭，返回被中断的情况
+func (rs *RPCServer) Shutdown(ctx context.Context) error {
 	// 从服务注册中心注销
 	if rs.cancelFunc != nil {
 		rs.cancelFunc()
+		rs.cancelFunc = nil
 	}
+	rs.unregisterServices()
 
 	// 关闭当前服务
-	if rs.listener != nil {
-		rs.listener.Shutdown()
+	if rs.listener == nil {
+		return nil
 	}
+	return rs.listener.Shutdown(ctx)
+}
+
+// Violations 获取连接违规计数
+func (rs *RPCServer) Violations() Violations {
+	return rs.listener.Violations()
 }
@@ -0,0 +1,160 @@
+package provider_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zhangweijie11/zRPC/consumer"
+	"github.com/zhangweijie11/zRPC/provider"
+	"github.com/zhangweijie11/zRPC/zrpctest"
+)
+
+// Gate 返回所在服务端的名称，Wait 阻塞到 release 关闭或调用方取消
+type Gate struct {
+	name    string
+	started chan struct{}
+	release chan struct{}
+}
+
+func newGate(name string) *Gate {
+	return &Gate{name: name, started: make(chan struct{}, 1), release: make(chan struct{})}
+}
+
+func (g *Gate) Name(ctx context.Context) (string, error) {
+	return g.name, nil
+}
+
+func (g *Gate) Wait(ctx context.Context) (string, error) {
+	g.started <- struct{}{}
+	select {
+	case <-g.release:
+		return g.name, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func startGate(gate *Gate, registry *zrpctest.Registry) *zrpctest.Server {
+	return zrpctest.NewServer(zrpctest.Config{Registry: registry}, func(rs *provider.RPCServer) {
+		rs.Register(gate)
+	})
+}
+
+var gateWait = &consumer.Service{Class: "Gate", Method: "Wait"}
+
+// 关闭中的服务端通过 GoAway 通知客户端，新调用发往其他服务端，处理中的调用正常完成
+func TestShutdownDrainsToOtherServer(t *testing.T) {
+	registry := zrpctest.NewRegistry()
+	a, b := newGate("a"), newGate("b")
+	srvA, srvB := startGate(a, registry), startGate(b, registry)
+	defer srvA.Close()
+	defer srvB.Close()
+
+	option := consumer.DefaultOption
+	// 快速失败，选中关闭中的服务端时不会被故障转移掩盖
+	option.FailMode = consumer.Failfast
+	proxy := srvA.Client(option)
+	name := func() (string, error) {
+		var get func() (string, error)
+		result, err := proxy.Call(context.Background(), zrpctest.DefaultAppID+".Gate.Name", &get)
+		if err != nil {
+			return "", err
+		}
+		return result.([]reflect.Value)[0].String(), nil
+	}
+	// 与两个服务端都建立连接
+	for i := 0; i < 2; i++ {
+		if _, err := name(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cli, err := srvA.NewClient(consumer.DefaultOption)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+	inflight := make(chan error, 1)
+	go func() {
+		res, err := cli.Call(context.Background(), gateWait, nil)
+		if err == nil && res[0] != "a" {
+			err = errors.New("in-flight call answered by the wrong server")
+		}
+		inflight <- err
+	}()
+	<-a.started
+
+	shutdown := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdown <- srvA.Shutdown(ctx)
+	}()
+	// 等待 GoAway 送达客户端
+	time.Sleep(50 * time.Millisecond)
+
+	for i := 0; i < 10; i++ {
+		got, err := name()
+		if err != nil {
+			t.Fatalf("call %d during shutdown: %v", i, err)
+		}
+		if got != "b" {
+			t.Fatalf("call %d during shutdown answered by %q, want b", i, got)
+		}
+	}
+
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Shutdown returned %v with a call in flight", err)
+	default:
+	}
+	close(a.release)
+	if err := <-inflight; err != nil {
+		t.Fatalf("in-flight call: %v", err)
+	}
+	if err := <-shutdown; err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+}
+
+// 等待超时后强制关闭剩余连接，中断的调用返回错误
+func TestShutdownForceClose(t *testing.T) {
+	gate := newGate("a")
+	srv := startGate(gate, nil)
+	defer srv.Close()
+
+	option := consumer.DefaultOption
+	option.ReadTimeout = 10 * time.Second
+	cli, err := srv.NewClient(option)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+	inflight := make(chan error, 1)
+	go func() {
+		_, err := cli.Call(context.Background(), gateWait, nil)
+		inflight <- err
+	}()
+	<-gate.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := srv.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown: got %v, want DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Shutdown returned after %v", elapsed)
+	}
+	select {
+	case err := <-inflight:
+		if err == nil {
+			t.Fatal("in-flight call succeeded after its connection was force-closed")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("in-flight call not interrupted by the force close")
+	}
+}
@@ -0,0 +1,174 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"github.com/zhangweijie11/zRPC/codec"
+	"github.com/zhangweijie11/zRPC/protocol"
+	"github.com/zhangweijie11/zRPC/status"
+	"reflect"
+	"strings"
+)
+
+// ServerStream 服务端流式方法向客户端发送结果的一端，方法签名为
+// func(ctx context.Context, req X, stream provider.ServerStream[Y]) error，方法返回后流结束。
+// 客户端接收慢时 Send 阻塞，直到客户端授予额度
+type ServerStream[Y any] struct {
+	*serverStream
+}
+
+// Send 发送一条结果
+func (s ServerStream[Y]) Send(v Y) error {
+	return s.send(v)
+}
+
+// ClientStream 客户端流式方法接收客户端数据的一端，方法签名为
+// func(ctx context.Context, stream provider.ClientStream[X]) (Y, error)，
+// 请求参数可放在 stream 之前。客户端结束发送后 Recv 返回 io.EOF，方法的返回值作为调用结果
+type ClientStream[X any] struct {
+	*serverStream
+}
+
+// Recv 接收下一条数据
+func (s ClientStream[X]) Recv() (X, error) {
+	return recvAs[X](s.serverStream)
+}
+
+// BidiStream 双向流式方法的一端，方法签名为
+// func(ctx context.Context, stream provider.BidiStream[X, Y]) error，请求参数可放在 stream 之前。
+// 收发相互独立，可在不同协程中进行，客户端结束发送后 Recv 返回 io.EOF，方法返回后流结束
+type BidiStream[X, Y any] struct {
+	*serverStream
+}
+
+// Recv 接收下一条数据
+func (s BidiStream[X, Y]) Recv() (X, error) {
+	return recvAs[X](s.serverStream)
+}
+
+// Send 发送一条结果
+func (s BidiStream[X, Y]) Send(v Y) error {
+	return s.send(v)
+}
+
+// serverStream 服务端的流，各类泛型流共用
+type serverStream struct {
+	ctx    context.Context
+	stream *protocol.Stream
+	coder  codec.Codec
+}
+
+// Context 流的上下文，客户端取消或连接断开时结束
+func (ss *serverStream) Context() context.Context {
+	return ss.ctx
+}
+
+func (ss *serverStream) send(v interface{}) error {
+	payload, err := ss.coder.Encode([]interface{}{v})
+	if err != nil {
+		return err
+	}
+	return ss.stream.Send(ss.ctx, payload)
+}
+
+// 接收客户端的下一条数据，客户端结束发送时返回 io.EOF
+func (ss *serverStream) recv() (interface{}, error) {
+	msg, err := ss.stream.Recv(ss.ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer msg.Release()
+	if msg.MsgType() != protocol.StreamData {
+		return nil, status.New(status.Canceled, "客户端异常结束流！")
+	}
+
+	item := make([]interface{}, 0, 1)
+	if err = ss.coder.Decode(msg.Payload, &item); err != nil {
+		return nil, status.Errorf(status.InvalidArgument, "解码流数据出现异常：%v", err)
+	}
+	if len(item) == 0 {
+		return nil, nil
+	}
+	return item[0], nil
+}
+
+func recvAs[X any](ss *serverStream) (X, error) {
+	var value X
+	item, err := ss.recv()
+	if err != nil || item == nil {
+		return value, err
+	}
+	value, ok := item.(X)
+	if !ok {
+		return value, status.Errorf(status.InvalidArgument, "流数据类型不匹配：%T", item)
+	}
+	return value, nil
+}
+
+// StreamKind 方法的调用方式
+type StreamKind int
+
+const (
+	Unary              StreamKind = iota // 普通调用
+	ServerStreamMethod                   // 服务端流
+	ClientStreamMethod                   // 客户端流
+	BidiStreamMethod                     // 双向流
+)
+
+// 接收客户端数据的调用方式，流建立时需向客户端授予额度
+func (kind StreamKind) receives() bool {
+	return kind == ClientStreamMethod || kind == BidiStreamMethod
+}
+
+var serverStreamType = reflect.TypeOf((*serverStream)(nil))
+
+// 根据方法签名判断调用方式：最后一个参数为 ServerStream[Y]、ClientStream[X]、BidiStream[X, Y] 时为对应的流式方法。
+// 流只能作为最后一个参数；客户端流方法需返回 (Y, error)，其余流式方法只返回 error
+func streamKindOf(methodType reflect.Type) (StreamKind, error) {
+	kind := Unary
+	for i := 0; i < methodType.NumIn(); i++ {
+		in := methodType.In(i)
+		var inKind StreamKind
+		switch {
+		case isStreamType(in, "ServerStream["):
+			inKind = ServerStreamMethod
+		case isStreamType(in, "ClientStream["):
+			inKind = ClientStreamMethod
+		case isStreamType(in, "BidiStream["):
+			inKind = BidiStreamMethod
+		default:
+			continue
+		}
+		if i != methodType.NumIn()-1 {
+			return Unary, errors.New("流只能作为最后一个参数")
+		}
+		kind = inKind
+	}
+	if kind == Unary {
+		return Unary, nil
+	}
+
+	numOut := 1
+	if kind == ClientStreamMethod {
+		numOut = 2
+	}
+	if methodType.NumOut() != numOut || methodType.Out(numOut-1) != errorType {
+		if kind == ClientStreamMethod {
+			return Unary, errors.New("客户端流方法需返回 (结果, error)")
+		}
+		return Unary, errors.New("流式方法需只返回 error")
+	}
+	return kind, nil
+}
+
+// 是否为本包中以 prefix 开头的泛型流类型
+func isStreamType(t reflect.Type, prefix string) bool {
+	return t.Kind() == reflect.Struct && t.PkgPath() == serverStreamType.Elem().PkgPath() &&
+		strings.HasPrefix(t.Name(), prefix) && t.NumField() == 1 &&
+		t.Field(0).Anonymous && t.Field(0).Type == serverStreamType
+}
+
+// 生成方法参数中泛型流类型的值，各泛型流类型的底层类型相同，可直接转换
+func newStreamArg(t reflect.Type, ss *serverStream) reflect.Value {
+	return reflect.ValueOf(struct{ *serverStream }{ss}).Convert(t)
+}
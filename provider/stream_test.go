@@ -0,0 +1,230 @@
+package provider_test
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zhangweijie11/zRPC/consumer"
+	"github.com/zhangweijie11/zRPC/provider"
+	"github.com/zhangweijie11/zRPC/zrpctest"
+)
+
+type Feed struct {
+	mutex sync.Mutex
+	sent  int
+
+	ended chan error // 无限流结束时的 ctx 错误
+}
+
+// Count 依次发送 0 到 n-1，记录已发送的条数
+func (f *Feed) Count(ctx context.Context, n int, stream provider.ServerStream[int]) error {
+	for i := 0; i < n; i++ {
+		if err := stream.Send(i); err != nil {
+			return err
+		}
+		f.mutex.Lock()
+		f.sent++
+		f.mutex.Unlock()
+	}
+	return nil
+}
+
+func (f *Feed) Sum(ctx context.Context, stream provider.ClientStream[int]) (int, error) {
+	sum := 0
+	for {
+		n, err := stream.Recv()
+		if err == io.EOF {
+			return sum, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		sum += n
+	}
+}
+
+func (f *Feed) Echo(ctx context.Context, stream provider.BidiStream[string, string]) error {
+	for {
+		s, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err = stream.Send("echo " + s); err != nil {
+			return err
+		}
+	}
+}
+
+// Forever 一直发送，直到调用方取消
+func (f *Feed) Forever(ctx context.Context, stream provider.ServerStream[int]) error {
+	for i := 0; ; i++ {
+		if err := stream.Send(i); err != nil {
+			f.ended <- ctx.Err()
+			return err
+		}
+	}
+}
+
+func (f *Feed) sentCount() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.sent
+}
+
+func startFeed(t *testing.T, option consumer.Option) (*Feed, *consumer.RPCClient) {
+	feed := &Feed{ended: make(chan error, 1)}
+	srv := zrpctest.NewServer(zrpctest.Config{}, func(rs *provider.RPCServer) {
+		rs.Register(feed)
+	})
+	t.Cleanup(srv.Close)
+	cli, err := srv.NewClient(option)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cli.Close)
+	return feed, cli
+}
+
+func feedMethod(method string) *consumer.Service {
+	return &consumer.Service{Class: "Feed", Method: method}
+}
+
+func TestServerStream(t *testing.T) {
+	_, cli := startFeed(t, consumer.DefaultOption)
+	cs, err := cli.NewStream(context.Background(), feedMethod("Count"), []interface{}{5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := consumer.NewStreamReader[int](cs)
+	for want := 0; want < 5; want++ {
+		got, err := reader.Recv()
+		if err != nil || got != want {
+			t.Fatalf("Recv = %d, %v; want %d", got, err, want)
+		}
+	}
+	if _, err = reader.Recv(); err != io.EOF {
+		t.Fatalf("Recv after the last item: got %v, want io.EOF", err)
+	}
+}
+
+func TestClientStream(t *testing.T) {
+	_, cli := startFeed(t, consumer.DefaultOption)
+	cs, err := cli.NewStream(context.Background(), feedMethod("Sum"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer := consumer.NewStreamWriter[int, int](cs)
+	for i := 1; i <= 100; i++ {
+		if err = writer.Send(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sum, err := writer.CloseAndRecv()
+	if err != nil || sum != 5050 {
+		t.Fatalf("CloseAndRecv = %d, %v; want 5050", sum, err)
+	}
+}
+
+func TestBidiStream(t *testing.T) {
+	_, cli := startFeed(t, consumer.DefaultOption)
+	cs, err := cli.NewStream(context.Background(), feedMethod("Echo"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rw := consumer.NewStreamReadWriter[string, string](cs)
+	for _, s := range []string{"a", "b", "c"} {
+		if err = rw.Send(s); err != nil {
+			t.Fatal(err)
+		}
+		got, err := rw.Recv()
+		if err != nil || got != "echo "+s {
+			t.Fatalf("Recv = %q, %v; want %q", got, err, "echo "+s)
+		}
+	}
+	if err = rw.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = rw.Recv(); err != io.EOF {
+		t.Fatalf("Recv after CloseSend: got %v, want io.EOF", err)
+	}
+}
+
+// 客户端不接收时服务端发满窗口后阻塞，客户端接收后授予额度，服务端继续发送
+func TestStreamWindowBlocksSender(t *testing.T) {
+	const window, total = 4, 20
+	option := consumer.DefaultOption
+	option.StreamWindow = window
+	feed, cli := startFeed(t, option)
+
+	cs, err := cli.NewStream(context.Background(), feedMethod("Count"), []interface{}{total})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if sent := feed.sentCount(); sent != window {
+		t.Fatalf("server sent %d items before any WindowUpdate, want the window of %d", sent, window)
+	}
+
+	reader := consumer.NewStreamReader[int](cs)
+	for want := 0; want < total; want++ {
+		got, err := reader.Recv()
+		if err != nil || got != want {
+			t.Fatalf("Recv = %d, %v; want %d", got, err, want)
+		}
+	}
+	if _, err = reader.Recv(); err != io.EOF {
+		t.Fatalf("Recv after the last item: got %v, want io.EOF", err)
+	}
+	if sent := feed.sentCount(); sent != total {
+		t.Fatalf("server sent %d items, want %d", sent, total)
+	}
+}
+
+// 接收中途关闭流或取消 ctx，服务端的方法随之取消
+func TestStreamCancel(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		abort func(*consumer.ClientStream, context.CancelFunc)
+	}{
+		{"Close", func(cs *consumer.ClientStream, _ context.CancelFunc) { cs.Close() }},
+		{"ctx", func(_ *consumer.ClientStream, cancel context.CancelFunc) { cancel() }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			option := consumer.DefaultOption
+			option.StreamWindow = 4
+			feed, cli := startFeed(t, option)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			cs, err := cli.NewStream(ctx, feedMethod("Forever"), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reader := consumer.NewStreamReader[int](cs)
+			for i := 0; i < 10; i++ {
+				if _, err = reader.Recv(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			tc.abort(cs, cancel)
+			select {
+			case err := <-feed.ended:
+				if err != context.Canceled {
+					t.Fatalf("server stream ended with ctx error %v, want context.Canceled", err)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("server stream not canceled")
+			}
+			if _, err = reader.Recv(); err == nil {
+				t.Fatal("Recv after abort succeeded")
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package provider_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zhangweijie11/zRPC/consumer"
+	"github.com/zhangweijie11/zRPC/naming"
+	"github.com/zhangweijie11/zRPC/provider"
+)
+
+// 测试时生成的自签名 CA
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "zrpc test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+// 签发叶子证书，template 中只需填写身份相关的字段
+func (ca *testCA) issue(t *testing.T, template *x509.Certificate, usage x509.ExtKeyUsage) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	template.ExtKeyUsage = []x509.ExtKeyUsage{usage}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+type Whoami struct{}
+
+func (w *Whoami) Identity(ctx context.Context) (string, error) {
+	peer, ok := provider.PeerFromContext(ctx)
+	if !ok {
+		return "", nil
+	}
+	return peer.Identity, nil
+}
+
+// 包装连接的接入插件，握手及对端证书需穿过包装取得
+type wrapPlugin struct{}
+
+type wrappedConn struct {
+	net.Conn
+}
+
+func (wrapPlugin) HandleConnAccept(conn net.Conn) (net.Conn, bool) {
+	return wrappedConn{conn}, true
+}
+
+// 在本地回环地址上启动要求客户端证书的 TLS 服务，返回注册的地址
+func startTLS(t *testing.T, ca *testCA) string {
+	option := provider.DefaultOption
+	option.Ip, option.Port, option.AppID = "127.0.0.1", 0, "tls"
+	option.TLSConfig = &tls.Config{
+		Certificates: []tls.Certificate{ca.issue(t, &x509.Certificate{
+			Subject:     pkix.Name{CommonName: "server"},
+			IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		}, x509.ExtKeyUsageServerAuth)},
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  ca.pool,
+	}
+	registry := naming.NewMemoryRegistry()
+	server := provider.NewRPCServer(option, registry)
+	server.AddPlugin(wrapPlugin{})
+	server.Register(&Whoami{})
+	server.Run()
+	t.Cleanup(server.Close)
+
+	instances, ok := registry.Fetch(context.Background(), "tls")
+	if !ok || len(instances) == 0 {
+		t.Fatal("TLS server not registered")
+	}
+	return instances[0].Addresses[0]
+}
+
+func tlsClientOption(ca *testCA, certs ...tls.Certificate) consumer.Option {
+	option := consumer.DefaultOption
+	option.ConnectionTimeout = time.Second
+	option.ReadTimeout = time.Second
+	option.TLSConfig = &tls.Config{RootCAs: ca.pool, Certificates: certs}
+	return option
+}
+
+var whoami = &consumer.Service{Class: "Whoami", Method: "Identity"}
+
+// 双向认证的调用经过包装连接的接入插件，处理方法能取得客户端证书的身份
+func TestMutualTLSIdentity(t *testing.T) {
+	ca := newTestCA(t)
+	addr := startTLS(t, ca)
+	if !strings.HasPrefix(addr, "tls://") {
+		t.Fatalf("registered address %q, want tls:// prefix", addr)
+	}
+
+	spiffe, _ := url.Parse("spiffe://zrpc/alice")
+	tests := []struct {
+		name     string
+		template *x509.Certificate
+		want     string
+	}{
+		{"URI SAN", &x509.Certificate{Subject: pkix.Name{CommonName: "alice"}, URIs: []*url.URL{spiffe}}, "spiffe://zrpc/alice"},
+		{"DNS SAN", &x509.Certificate{Subject: pkix.Name{CommonName: "alice"}, DNSNames: []string{"alice.zrpc"}}, "alice.zrpc"},
+		{"CN", &x509.Certificate{Subject: pkix.Name{CommonName: "alice"}}, "alice"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cli := consumer.NewClient(tlsClientOption(ca, ca.issue(t, tt.template, x509.ExtKeyUsageClientAuth)))
+			if err := cli.Connect(addr); err != nil {
+				t.Fatal(err)
+			}
+			defer cli.Close()
+			res, err := cli.Call(context.Background(), whoami, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(res) == 0 || res[0] != tt.want {
+				t.Fatalf("identity = %v, want %q", res, tt.want)
+			}
+		})
+	}
+}
+
+// 未提供证书的客户端无法完成调用
+func TestMutualTLSRejectsClientWithoutCert(t *testing.T) {
+	ca := newTestCA(t)
+	addr := startTLS(t, ca)
+
+	cli := consumer.NewClient(tlsClientOption(ca))
+	defer cli.Close()
+	if err := cli.Connect(addr); err != nil {
+		return
+	}
+	if _, err := cli.Call(context.Background(), whoami, nil); err == nil {
+		t.Fatal("call without a client certificate succeeded")
+	}
+}
+
+// 地址的协议前缀决定是否使用 TLS 拨号
+func TestTLSAddressSelectsDialer(t *testing.T) {
+	ca := newTestCA(t)
+	addr := startTLS(t, ca)
+	cert := ca.issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "alice"}}, x509.ExtKeyUsageClientAuth)
+
+	// 未配置 TLSConfig 时拒绝拨号 tls:// 地址
+	plain := consumer.NewClient(consumer.DefaultOption)
+	if err := plain.Connect(addr); err == nil || !strings.Contains(err.Error(), "TLS") {
+		plain.Close()
+		t.Fatalf("Connect %s without TLSConfig: got %v, want TLS required error", addr, err)
+	}
+
+	// 同一端口以 tcp:// 前缀明文拨号，TLS 服务端无法完成调用
+	option := tlsClientOption(ca, cert)
+	cli := consumer.NewClient(option)
+	if err := cli.Connect("tcp://" + strings.TrimPrefix(addr, "tls://")); err == nil {
+		if _, err = cli.Call(context.Background(), whoami, nil); err == nil {
+			t.Fatal("plaintext call to the TLS server succeeded")
+		}
+	}
+	cli.Close()
+
+	cli = consumer.NewClient(option)
+	defer cli.Close()
+	if err := cli.Connect(addr); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cli.Call(context.Background(), whoami, nil); err != nil {
+		t.Fatalf("call over tls://: %v", err)
+	}
+}
@@ -0,0 +1,203 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/base64"
+	"github.com/zhangweijie11/zRPC/provider"
+	"github.com/zhangweijie11/zRPC/status"
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	BrokerService   = "PubSubBroker"   // 代理服务的默认注册名
+	DeliveryService = "PubSubDelivery" // 客户端接收推送的回调服务名
+
+	// 每个订阅者默认的待推送队列长度
+	defaultQueueSize = 128
+)
+
+// BrokerOption 代理配置
+type BrokerOption struct {
+	QueueSize int // 每个订阅者的待推送队列长度，队列满时丢弃新消息，0 表示使用默认值
+}
+
+// Broker 发布订阅代理，作为普通服务注册到 RPC 服务端。客户端通过 Subscribe 订阅主题，
+// Publish 将消息放入各订阅者的队列，由订阅者各自的推送协程经客户端连接单向推送。
+// 消息至多投递一次：队列满、推送失败或连接断开时消息丢弃，不重试
+type Broker struct {
+	option BrokerOption
+
+	mutex       sync.RWMutex
+	topics      map[string]map[*subscriber]struct{} // 按主题索引的订阅者
+	subscribers map[*provider.Callback]*subscriber  // 按客户端连接索引的订阅者
+
+	dropped int64 // 因队列满丢弃的消息数
+}
+
+// 订阅者对应一个客户端连接，连接上订阅的所有主题共用一个推送队列
+type subscriber struct {
+	cb     *provider.Callback
+	queue  chan message
+	topics map[string]struct{} // 由 Broker.mutex 保护
+	stop   chan struct{}       // 取消所有订阅时关闭
+}
+
+type message struct {
+	topic   string
+	payload []byte
+}
+
+// NewBroker 初始化发布订阅代理
+func NewBroker(option BrokerOption) *Broker {
+	if option.QueueSize <= 0 {
+		option.QueueSize = defaultQueueSize
+	}
+	return &Broker{
+		option:      option,
+		topics:      make(map[string]map[*subscriber]struct{}),
+		subscribers: make(map[*provider.Callback]*subscriber),
+	}
+}
+
+// Subscribe 为发起调用的客户端连接订阅主题，连接断开时自动取消，仅 v2 连接支持
+func (b *Broker) Subscribe(ctx context.Context, topic string) error {
+	cb, ok := provider.CallbackFromContext(ctx)
+	if !ok {
+		return status.New(status.FailedPrecondition, "订阅需使用 v2 协议连接！")
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	sub, ok := b.subscribers[cb]
+	if !ok {
+		sub = &subscriber{
+			cb:     cb,
+			queue:  make(chan message, b.option.QueueSize),
+			topics: make(map[string]struct{}),
+			stop:   make(chan struct{}),
+		}
+		b.subscribers[cb] = sub
+		go b.deliver(sub)
+	}
+	sub.topics[topic] = struct{}{}
+	subs, ok := b.topics[topic]
+	if !ok {
+		subs = make(map[*subscriber]struct{})
+		b.topics[topic] = subs
+	}
+	subs[sub] = struct{}{}
+	return nil
+}
+
+// Unsubscribe 为发起调用的客户端连接取消订阅主题
+func (b *Broker) Unsubscribe(ctx context.Context, topic string) error {
+	cb, ok := provider.CallbackFromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	sub, ok := b.subscribers[cb]
+	if !ok {
+		return nil
+	}
+	b.unsubscribe(sub, topic)
+	if len(sub.topics) == 0 {
+		delete(b.subscribers, cb)
+		close(sub.stop)
+	}
+	return nil
+}
+
+// 需持有 mutex
+func (b *Broker) unsubscribe(sub *subscriber, topic string) {
+	delete(sub.topics, topic)
+	if subs, ok := b.topics[topic]; ok {
+		delete(subs, sub)
+		if len(subs) == 0 {
+			delete(b.topics, topic)
+		}
+	}
+}
+
+// Publish 向主题的所有订阅者发布消息，返回放入队列的订阅者数，队列已满的订阅者丢弃该消息。
+// 既可由客户端远程调用，也可在服务端进程内直接调用。payload 为 []byte，
+// 远程调用使用 JSON 编码时为 base64 字符串
+func (b *Broker) Publish(ctx context.Context, topic string, payload interface{}) (int, error) {
+	data, err := payloadBytes(payload)
+	if err != nil {
+		return 0, err
+	}
+
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	delivered := 0
+	for sub := range b.topics[topic] {
+		select {
+		case sub.queue <- message{topic: topic, payload: data}:
+			delivered++
+		default:
+			atomic.AddInt64(&b.dropped, 1)
+		}
+	}
+	return delivered, nil
+}
+
+// 还原消息内容。Gob 解码得到 []byte，JSON 将 []byte 编码为 base64 字符串，解码后为 string
+func payloadBytes(payload interface{}) ([]byte, error) {
+	switch v := payload.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		data, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return nil, status.Errorf(status.InvalidArgument, "消息内容不是合法的 base64 编码：%v", err)
+		}
+		return data, nil
+	case nil:
+		return nil, nil
+	default:
+		return nil, status.Errorf(status.InvalidArgument, "消息内容类型错误：%T", payload)
+	}
+}
+
+// Dropped 因订阅者队列已满丢弃的消息数
+func (b *Broker) Dropped() int64 {
+	return atomic.LoadInt64(&b.dropped)
+}
+
+// 推送协程，依次将队列中的消息推送给订阅者，连接断开或取消所有订阅后退出
+func (b *Broker) deliver(sub *subscriber) {
+	for {
+		select {
+		case msg := <-sub.queue:
+			if err := sub.cb.Notify(context.Background(), DeliveryService, "Deliver", msg.topic, msg.payload); err != nil {
+				log.Printf("推送主题 %s 的消息失败：%v\n", msg.topic, err)
+			}
+		case <-sub.stop:
+			return
+		case <-sub.cb.Done():
+			b.remove(sub)
+			return
+		}
+	}
+}
+
+// 连接断开，取消订阅者的所有订阅
+func (b *Broker) remove(sub *subscriber) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for topic := range sub.topics {
+		b.unsubscribe(sub, topic)
+	}
+	if b.subscribers[sub.cb] == sub {
+		delete(b.subscribers, sub.cb)
+	}
+}
@@ -0,0 +1,99 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"github.com/zhangweijie11/zRPC/consumer"
+	"log"
+	"sync"
+)
+
+// Handler 处理推送的消息，不同消息可能在不同协程中并发处理
+type Handler func(topic string, payload []byte)
+
+// Client 发布订阅客户端，通过 RPC 客户端的连接订阅代理上的主题并接收推送。
+// 订阅绑定在连接上，连接被替换（如服务端发送 GoAway 后重连）后需重新订阅
+type Client struct {
+	cli     *consumer.RPCClient
+	service string // 代理的服务名
+
+	mutex    sync.RWMutex
+	handlers map[string]Handler // 按主题索引的处理函数
+}
+
+// NewClient 初始化发布订阅客户端，在 cli 上注册接收推送的回调服务。
+// service 为代理的注册名，为空时使用 BrokerService
+func NewClient(cli *consumer.RPCClient, service string) *Client {
+	if service == "" {
+		service = BrokerService
+	}
+	c := &Client{cli: cli, service: service, handlers: make(map[string]Handler)}
+	cli.RegisterCallback(DeliveryService, &delivery{client: c})
+	return c
+}
+
+// Subscribe 订阅主题，handler 处理之后推送的消息，重复订阅时替换 handler
+func (c *Client) Subscribe(ctx context.Context, topic string, handler Handler) error {
+	c.mutex.Lock()
+	c.handlers[topic] = handler
+	c.mutex.Unlock()
+
+	_, err := c.cli.Call(ctx, &consumer.Service{Class: c.service, Method: "Subscribe"}, []interface{}{topic})
+	if err != nil {
+		c.mutex.Lock()
+		delete(c.handlers, topic)
+		c.mutex.Unlock()
+	}
+	return err
+}
+
+// Unsubscribe 取消订阅主题，已在途的推送会被丢弃
+func (c *Client) Unsubscribe(ctx context.Context, topic string) error {
+	c.mutex.Lock()
+	delete(c.handlers, topic)
+	c.mutex.Unlock()
+
+	_, err := c.cli.Call(ctx, &consumer.Service{Class: c.service, Method: "Unsubscribe"}, []interface{}{topic})
+	return err
+}
+
+// Publish 向主题发布消息，返回放入队列的订阅者数
+func (c *Client) Publish(ctx context.Context, topic string, payload []byte) (int, error) {
+	result, err := c.cli.Call(ctx, &consumer.Service{Class: c.service, Method: "Publish"}, []interface{}{topic, payload})
+	if err != nil {
+		return 0, err
+	}
+	if len(result) == 0 {
+		return 0, nil
+	}
+	// JSON 编码的数字解码为 float64
+	switch delivered := result[0].(type) {
+	case int:
+		return delivered, nil
+	case float64:
+		return int(delivered), nil
+	default:
+		return 0, fmt.Errorf("发布结果类型错误：%T", result[0])
+	}
+}
+
+// delivery 接收代理推送的回调服务
+type delivery struct {
+	client *Client
+}
+
+// Deliver 将推送的消息交给主题的处理函数，未订阅的主题丢弃。payload 的表示方式与 Broker.Publish 相同
+func (d *delivery) Deliver(topic string, payload interface{}) {
+	d.client.mutex.RLock()
+	handler, ok := d.client.handlers[topic]
+	d.client.mutex.RUnlock()
+	if !ok {
+		return
+	}
+	data, err := payloadBytes(payload)
+	if err != nil {
+		log.Printf("主题 %s 的推送内容无法解析：%v\n", topic, err)
+		return
+	}
+	handler(topic, data)
+}
@@ -0,0 +1,71 @@
+package pubsub_test
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/zhangweijie11/zRPC/consumer"
+	"github.com/zhangweijie11/zRPC/protocol"
+	"github.com/zhangweijie11/zRPC/provider"
+	"github.com/zhangweijie11/zRPC/pubsub"
+	"github.com/zhangweijie11/zRPC/zrpctest"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// 代理在 Gob 和 JSON 编码下都能发布并推送消息，推送内容与发布时一致
+func TestPublishSubscribe(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		serializeType protocol.SerializeType
+	}{
+		{"Gob", protocol.Gob},
+		{"JSON", protocol.JSON},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			broker := pubsub.NewBroker(pubsub.BrokerOption{})
+			srv := zrpctest.NewServer(zrpctest.Config{}, func(rs *provider.RPCServer) {
+				rs.RegisterName(pubsub.BrokerService, broker)
+			})
+			defer srv.Close()
+
+			option := consumer.DefaultOption
+			option.SerializeType = tc.serializeType
+			cli, err := srv.NewClient(option)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cli.Close()
+
+			received := make(chan []byte, 1)
+			pc := pubsub.NewClient(cli, "")
+			err = pc.Subscribe(context.Background(), "cache", func(topic string, payload []byte) {
+				received <- payload
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			payload := []byte{0, 1, 2, 0xFF, 'u', 's', 'e', 'r'}
+			n, err := pc.Publish(context.Background(), "cache", payload)
+			if err != nil || n != 1 {
+				t.Fatalf("Publish = %d, %v; want 1, nil", n, err)
+			}
+			select {
+			case got := <-received:
+				if string(got) != string(payload) {
+					t.Fatalf("delivered %v, want %v", got, payload)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("message not delivered")
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package status
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+)
+
+// Code 调用错误码
+type Code uint32
+
+const (
+	OK                 Code = iota // 成功
+	Canceled                       // 调用被取消
+	Unknown                        // 未知错误
+	InvalidArgument                // 参数错误
+	DeadlineExceeded               // 调用超时
+	NotFound                       // 服务或方法不存在
+	AlreadyExists                  // 资源已存在
+	PermissionDenied               // 无权限
+	ResourceExhausted              // 资源耗尽，如超过并发限制
+	FailedPrecondition             // 前置条件不满足
+	Aborted                        // 调用中止
+	OutOfRange                     // 超出范围
+	Unimplemented                  // 未实现
+	Internal                       // 服务内部错误
+	Unavailable                    // 服务不可用，如连接失败
+	DataLoss                       // 数据丢失或损坏
+	Unauthenticated                // 未认证
+)
+
+var codeNames = map[Code]string{
+	OK:                 "OK",
+	Canceled:           "Canceled",
+	Unknown:            "Unknown",
+	InvalidArgument:    "InvalidArgument",
+	DeadlineExceeded:   "DeadlineExceeded",
+	NotFound:           "NotFound",
+	AlreadyExists:      "AlreadyExists",
+	PermissionDenied:   "PermissionDenied",
+	ResourceExhausted:  "ResourceExhausted",
+	FailedPrecondition: "FailedPrecondition",
+	Aborted:            "Aborted",
+	OutOfRange:         "OutOfRange",
+	Unimplemented:      "Unimplemented",
+	Internal:           "Internal",
+	Unavailable:        "Unavailable",
+	DataLoss:           "DataLoss",
+	Unauthenticated:    "Unauthenticated",
+}
+
+func (c Code) String() string {
+	if name, ok := codeNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("Code(%d)", uint32(c))
+}
+
+// Error 带错误码的调用错误
+type Error struct {
+	Code    Code
+	Message string
+}
+
+// New 初始化错误
+func New(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Errorf 按格式初始化错误
+func Errorf(code Code, format string, args ...interface{}) *Error {
+	return New(code, fmt.Sprintf(format, args...))
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("rpc error: code = %s desc = %s", e.Code, e.Message)
+}
+
+// CodeOf 获取错误对应的错误码，非 *Error 的错误按类型推断
+func CodeOf(err error) Code {
+	if err == nil {
+		return OK
+	}
+
+	var statusErr *Error
+	if errors.As(err, &statusErr) {
+		return statusErr.Code
+	}
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return DeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		return Canceled
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.ErrClosedPipe), errors.Is(err, net.ErrClosed):
+		return Unavailable
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return DeadlineExceeded
+		}
+		return Unavailable
+	}
+
+	return Unknown
+}
+
+// Convert 将任意错误转换为 *Error，非 *Error 的错误按类型推断错误码
+func Convert(err error) *Error {
+	var statusErr *Error
+	if errors.As(err, &statusErr) {
+		return statusErr
+	}
+	return New(CodeOf(err), err.Error())
+}
+
+// Marshal 编码为错误响应的消息体：错误码（4 字节）+ 错误信息
+func (e *Error) Marshal() []byte {
+	data := make([]byte, 4+len(e.Message))
+	binary.BigEndian.PutUint32(data, uint32(e.Code))
+	copy(data[4:], e.Message)
+	return data
+}
+
+// Unmarshal 从错误响应的消息体解码错误
+func Unmarshal(data []byte) *Error {
+	if len(data) < 4 {
+		return New(DataLoss, "错误响应格式错误！")
+	}
+	return New(Code(binary.BigEndian.Uint32(data)), string(data[4:]))
+}
@@ -0,0 +1,118 @@
+package transport
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// Memory 进程内的传输方式，地址为任意名字，连接由 net.Pipe 建立，不经过网络，适用于测试
+var Memory = &memoryTransport{listeners: make(map[string]*memoryListener)}
+
+type memoryTransport struct {
+	mutex     sync.Mutex
+	listeners map[string]*memoryListener
+}
+
+func (mt *memoryTransport) Scheme() string {
+	return SchemeMemory
+}
+
+func (mt *memoryTransport) Listen(addr string) (net.Listener, error) {
+	mt.mutex.Lock()
+	defer mt.mutex.Unlock()
+
+	if _, ok := mt.listeners[addr]; ok {
+		return nil, fmt.Errorf("内存地址 %s 已被监听", addr)
+	}
+	ml := &memoryListener{
+		transport: mt,
+		addr:      memoryAddr(addr),
+		conns:     make(chan net.Conn),
+		done:      make(chan struct{}),
+	}
+	mt.listeners[addr] = ml
+	return ml, nil
+}
+
+func (mt *memoryTransport) Dial(addr string, timeout time.Duration) (net.Conn, error) {
+	mt.mutex.Lock()
+	ml, ok := mt.listeners[addr]
+	mt.mutex.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("内存地址 %s 未监听", addr)
+	}
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	client, server := net.Pipe()
+	select {
+	case ml.conns <- &memoryConn{Conn: server, local: ml.addr, remote: memoryAddr("client")}:
+		return &memoryConn{Conn: client, local: memoryAddr("client"), remote: ml.addr}, nil
+	case <-ml.done:
+		return nil, fmt.Errorf("内存地址 %s 已关闭", addr)
+	case <-expired:
+		return nil, fmt.Errorf("连接内存地址 %s 超时", addr)
+	}
+}
+
+type memoryListener struct {
+	transport *memoryTransport
+	addr      memoryAddr
+	conns     chan net.Conn
+	done      chan struct{}
+	once      sync.Once
+}
+
+func (ml *memoryListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-ml.conns:
+		return conn, nil
+	case <-ml.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (ml *memoryListener) Close() error {
+	ml.once.Do(func() {
+		close(ml.done)
+		ml.transport.mutex.Lock()
+		delete(ml.transport.listeners, string(ml.addr))
+		ml.transport.mutex.Unlock()
+	})
+	return nil
+}
+
+func (ml *memoryListener) Addr() net.Addr {
+	return ml.addr
+}
+
+// 内存连接的地址
+type memoryAddr string
+
+func (a memoryAddr) Network() string {
+	return SchemeMemory
+}
+
+func (a memoryAddr) String() string {
+	return string(a)
+}
+
+// net.Pipe 的地址没有意义，替换为监听的名字
+type memoryConn struct {
+	net.Conn
+	local, remote net.Addr
+}
+
+func (c *memoryConn) LocalAddr() net.Addr {
+	return c.local
+}
+
+func (c *memoryConn) RemoteAddr() net.Addr {
+	return c.remote
+}
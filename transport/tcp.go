@@ -0,0 +1,57 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"time"
+)
+
+// TCP 基于 TCP 的传输方式
+type TCP struct{}
+
+func (TCP) Scheme() string {
+	return SchemeTCP
+}
+
+func (TCP) Listen(addr string) (net.Listener, error) {
+	return net.Listen("tcp", addr)
+}
+
+func (TCP) Dial(addr string, timeout time.Duration) (net.Conn, error) {
+	return net.DialTimeout("tcp", addr, timeout)
+}
+
+// Unix 基于 Unix 域套接字的传输方式，地址为套接字文件路径，适用于同一主机上的边车部署
+type Unix struct{}
+
+func (Unix) Scheme() string {
+	return SchemeUnix
+}
+
+// 探测遗留套接字文件是否仍有进程监听的超时时间
+const staleProbeTimeout = 100 * time.Millisecond
+
+// Listen 监听套接字文件。进程异常退出遗留的套接字文件（连接被拒绝）会被删除，
+// 仍有进程监听的套接字文件及同名的普通文件不会
+func (Unix) Listen(addr string) (net.Listener, error) {
+	if info, err := os.Lstat(addr); err == nil && info.Mode()&os.ModeSocket != 0 {
+		conn, err := net.DialTimeout("unix", addr, staleProbeTimeout)
+		if err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("套接字 %s 已被其他进程监听", addr)
+		}
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			if err = os.Remove(addr); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return nil, err
+			}
+		}
+	}
+	return net.Listen("unix", addr)
+}
+
+func (Unix) Dial(addr string, timeout time.Duration) (net.Conn, error) {
+	return net.DialTimeout("unix", addr, timeout)
+}
@@ -0,0 +1,75 @@
+package transport
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// 进程异常退出遗留的套接字文件被替换
+func TestUnixListenReplacesStaleSocket(t *testing.T) {
+	addr := filepath.Join(t.TempDir(), "stale.sock")
+	stale, err := net.Listen("unix", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 关闭时保留套接字文件，模拟进程异常退出
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+	if _, err = os.Lstat(addr); err != nil {
+		t.Fatalf("stale socket file missing: %v", err)
+	}
+
+	ln, err := Unix{}.Listen(addr)
+	if err != nil {
+		t.Fatalf("Listen over a stale socket: %v", err)
+	}
+	defer ln.Close()
+	conn, err := Unix{}.Dial(addr, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+}
+
+// 仍有进程监听的套接字文件不被删除
+func TestUnixListenKeepsLiveSocket(t *testing.T) {
+	addr := filepath.Join(t.TempDir(), "live.sock")
+	live, err := Unix{}.Listen(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer live.Close()
+
+	if ln, err := (Unix{}).Listen(addr); err == nil {
+		ln.Close()
+		t.Fatal("Listen on a live socket succeeded")
+	}
+	go func() {
+		if conn, err := live.Accept(); err == nil {
+			conn.Close()
+		}
+	}()
+	conn, err := Unix{}.Dial(addr, time.Second)
+	if err != nil {
+		t.Fatalf("live listener lost its socket: %v", err)
+	}
+	conn.Close()
+}
+
+// 同名的普通文件不被删除
+func TestUnixListenKeepsRegularFile(t *testing.T) {
+	addr := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(addr, []byte("data"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if ln, err := (Unix{}).Listen(addr); err == nil {
+		ln.Close()
+		t.Fatal("Listen over a regular file succeeded")
+	}
+	if data, err := os.ReadFile(addr); err != nil || string(data) != "data" {
+		t.Fatalf("regular file changed: %q %v", data, err)
+	}
+}
@@ -0,0 +1,82 @@
+package transport
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 内置传输方式的协议前缀
+const (
+	SchemeTCP    = "tcp"
+	SchemeUnix   = "unix"
+	SchemeMemory = "mem"
+	// SchemeTLS TCP 上的 TLS 连接，其他传输方式开启 TLS 时在前缀后追加 tlsSuffix，如 unix+tls
+	SchemeTLS = "tls"
+	tlsSuffix = "+tls"
+)
+
+// Transport 传输方式，负责监听及建立连接，连接之上的协议与传输方式无关
+type Transport interface {
+	Scheme() string // 注册地址中的协议前缀
+	Listen(addr string) (net.Listener, error)
+	Dial(addr string, timeout time.Duration) (net.Conn, error)
+}
+
+var (
+	mutex      sync.RWMutex
+	transports = map[string]Transport{
+		SchemeTCP:    TCP{},
+		SchemeUnix:   Unix{},
+		SchemeMemory: Memory,
+	}
+)
+
+// Register 注册传输方式，相同前缀的传输方式会被替换
+func Register(t Transport) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	transports[t.Scheme()] = t
+}
+
+// Get 按协议前缀获取传输方式
+func Get(scheme string) (Transport, error) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	t, ok := transports[scheme]
+	if !ok {
+		return nil, fmt.Errorf("不支持的传输协议：%s", scheme)
+	}
+	return t, nil
+}
+
+// FormatAddr 生成注册地址，如 tcp://127.0.0.1:8080、tls://127.0.0.1:8080、unix:///run/app.sock
+func FormatAddr(scheme string, useTLS bool, addr string) string {
+	if useTLS {
+		if scheme == SchemeTCP {
+			scheme = SchemeTLS
+		} else {
+			scheme += tlsSuffix
+		}
+	}
+	return scheme + "://" + addr
+}
+
+// ParseAddr 解析注册地址，返回传输方式的协议前缀、是否使用 TLS 及地址。没有前缀时 ok 为 false
+func ParseAddr(addr string) (scheme string, useTLS bool, address string, ok bool) {
+	scheme, address, ok = strings.Cut(addr, "://")
+	if !ok {
+		return "", false, addr, false
+	}
+	switch {
+	case scheme == SchemeTLS:
+		return SchemeTCP, true, address, true
+	case strings.HasSuffix(scheme, tlsSuffix):
+		return strings.TrimSuffix(scheme, tlsSuffix), true, address, true
+	default:
+		return scheme, false, address, true
+	}
+}
@@ -0,0 +1,91 @@
+package zrpctest
+
+import (
+	"context"
+	"github.com/zhangweijie11/zRPC/provider"
+	"sync"
+	"time"
+)
+
+// Fault 注入的故障
+type Fault struct {
+	Method  string        // 作用的方法，格式为 "服务名.方法名"，为空时作用于所有方法
+	Latency time.Duration // 执行方法前的延迟，调用方取消时提前结束
+	Err     error         // 不为空时不执行方法，直接返回该错误
+	Drop    bool          // 关闭服务端的所有连接，调用方收到连接断开的错误
+	Times   int           // 生效的次数，0 表示一直生效
+}
+
+// Faults 服务端的故障注入，按方法匹配，方法没有单独的故障时使用作用于所有方法的故障
+type Faults struct {
+	mutex  sync.Mutex
+	faults map[string]*Fault
+	drop   func() // 关闭服务端的所有连接
+}
+
+func newFaults(drop func()) *Faults {
+	return &Faults{faults: make(map[string]*Fault), drop: drop}
+}
+
+// Set 注入故障，替换同一方法上已有的故障
+func (f *Faults) Set(fault Fault) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.faults[fault.Method] = &fault
+}
+
+// Clear 清除所有故障
+func (f *Faults) Clear() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.faults = make(map[string]*Fault)
+}
+
+// 取出方法对应的故障，有次数限制的故障计一次
+func (f *Faults) take(method string) (Fault, bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	key := method
+	fault, ok := f.faults[key]
+	if !ok {
+		key = ""
+		if fault, ok = f.faults[key]; !ok {
+			return Fault{}, false
+		}
+	}
+	if fault.Times > 0 {
+		fault.Times--
+		if fault.Times == 0 {
+			delete(f.faults, key)
+		}
+	}
+	return *fault, true
+}
+
+// 注入故障的拦截器，作用于服务端的所有服务
+func (f *Faults) interceptor() provider.Interceptor {
+	return func(ctx context.Context, info *provider.MethodInfo, args []interface{}, next provider.UnaryHandler) ([]interface{}, error) {
+		fault, ok := f.take(info.Class + "." + info.Method)
+		if !ok {
+			return next(ctx, args)
+		}
+		if fault.Latency > 0 {
+			timer := time.NewTimer(fault.Latency)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, ctx.Err()
+			}
+		}
+		if fault.Drop {
+			f.drop()
+			return nil, context.Canceled
+		}
+		if fault.Err != nil {
+			return nil, fault.Err
+		}
+		return next(ctx, args)
+	}
+}
@@ -0,0 +1,15 @@
+package zrpctest
+
+import (
+	"github.com/zhangweijie11/zRPC/naming"
+)
+
+// Registry 内存中的服务注册中心，代替 HTTP 注册中心用于测试，支持变化通知
+type Registry struct {
+	*naming.MemoryRegistry
+}
+
+// NewRegistry 初始化内存注册中心
+func NewRegistry() *Registry {
+	return &Registry{MemoryRegistry: naming.NewMemoryRegistry()}
+}
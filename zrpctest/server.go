@@ -0,0 +1,161 @@
+package zrpctest
+
+import (
+	"fmt"
+	"github.com/zhangweijie11/zRPC/consumer"
+	"github.com/zhangweijie11/zRPC/provider"
+	"github.com/zhangweijie11/zRPC/transport"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultAppID 未指定 AppID 时服务注册使用的应用名
+const DefaultAppID = "zrpctest"
+
+// 内存地址的序号，保证每个服务的地址不同
+var serverSeq int64
+
+// Config 测试服务配置
+type Config struct {
+	AppID    string          // 注册的应用名，为空时使用 DefaultAppID
+	Registry *Registry       // 注册中心，多个服务共用时可测试故障转移，为空时新建
+	Option   provider.Option // 服务端配置，传输方式及监听地址会被替换为内存地址
+}
+
+// Server 在内存地址上运行的 RPC 服务，不占用端口，不依赖注册中心服务
+type Server struct {
+	*provider.RPCServer
+	AppID    string
+	Addr     string // 注册的地址，形如 mem://zrpctest-1
+	Registry *Registry
+	Faults   *Faults // 故障注入
+
+	listener *trackingListener
+}
+
+// NewServer 启动测试服务，register 在启动前注册服务
+func NewServer(config Config, register func(*provider.RPCServer)) *Server {
+	if config.AppID == "" {
+		config.AppID = DefaultAppID
+	}
+	if config.Registry == nil {
+		config.Registry = NewRegistry()
+	}
+
+	srv := &Server{AppID: config.AppID, Registry: config.Registry}
+	option := config.Option
+	option.AppID = config.AppID
+	option.Transport = &trackingTransport{server: srv}
+	option.Address = fmt.Sprintf("zrpctest-%d", atomic.AddInt64(&serverSeq, 1))
+	if option.ReadTimeout == 0 && option.WriteTimeout == 0 && option.HeaderTimeout == 0 {
+		option.ReadTimeout = provider.DefaultOption.ReadTimeout
+		option.WriteTimeout = provider.DefaultOption.WriteTimeout
+		option.HeaderTimeout = provider.DefaultOption.HeaderTimeout
+	}
+
+	srv.RPCServer = provider.NewRPCServer(option, config.Registry)
+	srv.Faults = newFaults(srv.DropConnections)
+	// 故障注入位于最外层，先于业务拦截器生效
+	srv.Use(srv.Faults.interceptor())
+	if register != nil {
+		register(srv.RPCServer)
+	}
+	srv.Run()
+	srv.Addr = srv.listener.addr
+	return srv
+}
+
+// Client 创建通过注册中心发现本服务的客户端代理，共用注册中心的其他服务同样会被发现
+func (srv *Server) Client(option consumer.Option) consumer.ClientProxy {
+	return consumer.NewRPCClientProxy(srv.AppID, option, srv.Registry)
+}
+
+// NewClient 创建直连本服务的客户端
+func (srv *Server) NewClient(option consumer.Option) (*consumer.RPCClient, error) {
+	cli := consumer.NewClient(option)
+	if err := cli.Connect(srv.Addr); err != nil {
+		return nil, err
+	}
+	return cli, nil
+}
+
+// DropConnections 关闭当前的所有连接，模拟网络中断，之后的新连接不受影响
+func (srv *Server) DropConnections() {
+	srv.listener.dropAll()
+}
+
+// Close 从注册中心注销并关闭服务，关闭所有连接
+func (srv *Server) Close() {
+	srv.RPCServer.Close()
+	srv.DropConnections()
+}
+
+// 在内存传输方式上记录服务端的连接，以便模拟连接中断
+type trackingTransport struct {
+	server *Server
+}
+
+func (tt *trackingTransport) Scheme() string {
+	return transport.SchemeMemory
+}
+
+func (tt *trackingTransport) Listen(addr string) (net.Listener, error) {
+	l, err := transport.Memory.Listen(addr)
+	if err != nil {
+		return nil, err
+	}
+	tt.server.listener = &trackingListener{
+		Listener: l,
+		addr:     transport.FormatAddr(transport.SchemeMemory, false, addr),
+		conns:    make(map[net.Conn]struct{}),
+	}
+	return tt.server.listener, nil
+}
+
+func (tt *trackingTransport) Dial(addr string, timeout time.Duration) (net.Conn, error) {
+	return transport.Memory.Dial(addr, timeout)
+}
+
+type trackingListener struct {
+	net.Listener
+	addr string
+
+	mutex sync.Mutex
+	conns map[net.Conn]struct{}
+}
+
+func (tl *trackingListener) Accept() (net.Conn, error) {
+	conn, err := tl.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	tc := &trackedConn{Conn: conn, listener: tl}
+	tl.mutex.Lock()
+	tl.conns[tc] = struct{}{}
+	tl.mutex.Unlock()
+	return tc, nil
+}
+
+func (tl *trackingListener) dropAll() {
+	tl.mutex.Lock()
+	conns := tl.conns
+	tl.conns = make(map[net.Conn]struct{})
+	tl.mutex.Unlock()
+	for conn := range conns {
+		conn.Close()
+	}
+}
+
+type trackedConn struct {
+	net.Conn
+	listener *trackingListener
+}
+
+func (tc *trackedConn) Close() error {
+	tc.listener.mutex.Lock()
+	delete(tc.listener.conns, tc)
+	tc.listener.mutex.Unlock()
+	return tc.Conn.Close()
+}
@@ -0,0 +1,146 @@
+package zrpctest_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"os"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zhangweijie11/zRPC/consumer"
+	"github.com/zhangweijie11/zRPC/provider"
+	"github.com/zhangweijie11/zRPC/status"
+	"github.com/zhangweijie11/zRPC/zrpctest"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+type Greeter struct{}
+
+func (g *Greeter) Hello(ctx context.Context, name string) (string, error) {
+	return "hello " + name, nil
+}
+
+func (g *Greeter) Bye(ctx context.Context, name string) (string, error) {
+	return "bye " + name, nil
+}
+
+// 统计服务端接受的连接数
+type acceptCounter struct {
+	n int32
+}
+
+func (ac *acceptCounter) HandleConnAccept(conn net.Conn) (net.Conn, bool) {
+	atomic.AddInt32(&ac.n, 1)
+	return conn, true
+}
+
+func startGreeter(t *testing.T) (*zrpctest.Server, *acceptCounter) {
+	counter := &acceptCounter{}
+	srv := zrpctest.NewServer(zrpctest.Config{}, func(rs *provider.RPCServer) {
+		rs.AddPlugin(counter)
+		rs.Register(&Greeter{})
+	})
+	t.Cleanup(srv.Close)
+	return srv, counter
+}
+
+func call(ctx context.Context, proxy consumer.ClientProxy, method string) (string, error) {
+	var stub func(string) (string, error)
+	result, err := proxy.Call(ctx, zrpctest.DefaultAppID+".Greeter."+method, &stub, "zrpc")
+	if err != nil {
+		return "", err
+	}
+	return result.([]reflect.Value)[0].String(), nil
+}
+
+// 注入的延迟超过调用方的超时时间
+func TestFaultLatency(t *testing.T) {
+	srv, _ := startGreeter(t)
+	proxy := srv.Client(consumer.DefaultOption)
+	srv.Faults.Set(zrpctest.Fault{Method: "Greeter.Hello", Latency: time.Second})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := call(ctx, proxy, "Hello"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("call returned after %v", elapsed)
+	}
+	if got, err := call(context.Background(), proxy, "Bye"); err != nil || got != "bye zrpc" {
+		t.Fatalf("Bye = %q, %v; latency leaked to another method", got, err)
+	}
+}
+
+// 注入的错误带着错误码返回给调用方
+func TestFaultError(t *testing.T) {
+	srv, _ := startGreeter(t)
+	proxy := srv.Client(consumer.DefaultOption)
+	srv.Faults.Set(zrpctest.Fault{Method: "Greeter.Hello", Err: status.New(status.NotFound, "no such user")})
+
+	if _, err := call(context.Background(), proxy, "Hello"); status.CodeOf(err) != status.NotFound {
+		t.Fatalf("got %v, want NotFound", err)
+	}
+	if _, err := call(context.Background(), proxy, "Bye"); err != nil {
+		t.Fatalf("Bye: %v", err)
+	}
+	srv.Faults.Clear()
+	if _, err := call(context.Background(), proxy, "Hello"); err != nil {
+		t.Fatalf("Hello after Clear: %v", err)
+	}
+}
+
+// 限定次数的故障用完后自动清除
+func TestFaultTimes(t *testing.T) {
+	srv, _ := startGreeter(t)
+	proxy := srv.Client(consumer.DefaultOption)
+	srv.Faults.Set(zrpctest.Fault{Err: status.New(status.PermissionDenied, "denied"), Times: 1})
+
+	if _, err := call(context.Background(), proxy, "Hello"); status.CodeOf(err) != status.PermissionDenied {
+		t.Fatalf("first call: got %v, want PermissionDenied", err)
+	}
+	for i := 0; i < 3; i++ {
+		if got, err := call(context.Background(), proxy, "Hello"); err != nil || got != "hello zrpc" {
+			t.Fatalf("call %d after the one-shot fault: %q, %v", i, got, err)
+		}
+	}
+}
+
+// 断开连接后客户端代理重新连接
+func TestDropConnections(t *testing.T) {
+	srv, accepted := startGreeter(t)
+	proxy := srv.Client(consumer.DefaultOption)
+	if _, err := call(context.Background(), proxy, "Hello"); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&accepted.n); n != 1 {
+		t.Fatalf("accepted %d connections, want 1", n)
+	}
+
+	srv.DropConnections()
+	if got, err := call(context.Background(), proxy, "Hello"); err != nil || got != "hello zrpc" {
+		t.Fatalf("call after DropConnections: %q, %v", got, err)
+	}
+	if n := atomic.LoadInt32(&accepted.n); n != 2 {
+		t.Fatalf("accepted %d connections, want a redial", n)
+	}
+
+	// 注入的断开故障使调用收到 Unavailable，客户端代理重新连接后重试成功
+	srv.Faults.Set(zrpctest.Fault{Drop: true, Times: 1})
+	if got, err := call(context.Background(), proxy, "Hello"); err != nil || got != "hello zrpc" {
+		t.Fatalf("call with a Drop fault: %q, %v", got, err)
+	}
+	if n := atomic.LoadInt32(&accepted.n); n != 3 {
+		t.Fatalf("accepted %d connections, want 3", n)
+	}
+}